@@ -0,0 +1,132 @@
+// Package bolt implements a persistent db.Db backend that stores
+// intervals in a bbolt key-value file.
+package bolt
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+	"github.com/stevegt/timectl/v3/db"
+	"go.etcd.io/bbolt"
+)
+
+// Bolt must satisfy the db.Db interface.
+var _ db.Db = (*Bolt)(nil)
+
+// Bucket names.  The interval bucket maps ids to encoded intervals.
+// The other buckets are indexes whose keys are the indexed value
+// followed by the id, so intervals that share a value keep distinct
+// keys, in the same way as the non-unique go-memdb indexes in the mem
+// backend.  The resource_start and resource_end buckets are prefixed
+// by the resource key, for the Find* methods.
+var (
+	intervalBucket      = []byte("interval")
+	startBucket         = []byte("start")
+	endBucket           = []byte("end")
+	priorityBucket      = []byte("priority")
+	resourceStartBucket = []byte("resource_start")
+	resourceEndBucket   = []byte("resource_end")
+)
+
+// Bolt is a persistent database stored in a bbolt file.
+type Bolt struct {
+	bdb   *bbolt.DB
+	codec db.Codec
+}
+
+// NewBolt opens the database stored in the file at path, creating the
+// file if it does not exist.  Payloads are serialized with codec; if
+// codec is nil, db.GobCodec is used.
+func NewBolt(path string, codec db.Codec) (b *Bolt, err error) {
+	defer Return(&err)
+
+	if codec == nil {
+		codec = db.GobCodec{}
+	}
+
+	bdb, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+	Ck(err)
+
+	// create the buckets
+	err = bdb.Update(func(btx *bbolt.Tx) error {
+		for _, name := range [][]byte{intervalBucket, startBucket, endBucket, priorityBucket, resourceStartBucket, resourceEndBucket} {
+			_, err := btx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		bdb.Close()
+		Ck(err)
+	}
+
+	b = &Bolt{bdb: bdb, codec: codec}
+	return
+}
+
+// NewTx returns a transaction for the database.  If the write
+// parameter is true, the transaction is a write transaction.  Only
+// one write transaction can be open at a time; NewTx blocks until any
+// other write transaction is committed or aborted.
+func (b *Bolt) NewTx(write bool) db.Tx {
+	btx, err := b.bdb.Begin(write)
+	return &BoltTx{tx: btx, codec: b.codec, err: err}
+}
+
+// Close closes the database file.  Any open transactions must be
+// committed or aborted first.
+func (b *Bolt) Close() error {
+	return b.bdb.Close()
+}
+
+// idKey encodes an id as an 8-byte big-endian key.
+func idKey(id uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, id)
+	return buf
+}
+
+// timeKey encodes a time so that byte order matches time order, using
+// the same encoding as the mem backend's TimeFieldIndex.
+func timeKey(t time.Time) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(t.UnixNano()^math.MinInt64))
+	return buf
+}
+
+// floatKey encodes a float so that byte order matches numeric order
+// for non-negative values, using the same encoding as the mem
+// backend's FloatFieldIndex.
+func floatKey(f float64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, math.Float64bits(f))
+	return buf
+}
+
+// indexKey appends the id key to an index value.
+func indexKey(val []byte, id uint64) []byte {
+	return append(val, idKey(id)...)
+}
+
+// resourceKey encodes a resource name as its length followed by the
+// name, using the same encoding as the mem backend's
+// ResourceFieldIndex, so no resource key is a prefix of another.
+func resourceKey(resource string) []byte {
+	buf := make([]byte, 4, 4+len(resource))
+	binary.BigEndian.PutUint32(buf, uint32(len(resource)))
+	return append(buf, resource...)
+}
+
+// resourceIndexKey prefixes an index key with a resource key.
+func resourceIndexKey(resource string, key []byte) []byte {
+	return append(resourceKey(resource), key...)
+}
+
+// keyId extracts the id from an index key.
+func keyId(key []byte) uint64 {
+	return binary.BigEndian.Uint64(key[len(key)-8:])
+}
@@ -0,0 +1,60 @@
+package bolt
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/davecgh/go-spew/spew"
+	. "github.com/stevegt/goadapt"
+	"github.com/stevegt/timectl/v3/db"
+	"github.com/stevegt/timectl/v3/db/dbtest"
+)
+
+func TestBoltConformance(t *testing.T) {
+	dir := t.TempDir()
+	n := 0
+	dbtest.Run(t, func() (db.Db, error) {
+		n++
+		return NewBolt(filepath.Join(dir, Spf("test%d.db", n)), nil)
+	})
+}
+
+func TestBoltPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	// add some intervals and close the database
+	bdb, err := NewBolt(path, nil)
+	Tassert(t, err == nil, "NewBolt() failed: %v", err)
+	tx := bdb.NewTx(true)
+	i0900_1000 := db.Tadd(tx, 10, "2024-01-01T09:00:00", "2024-01-01T10:00:00", 2.0)
+	i0900_1000.Payload = "standup"
+	err = tx.Delete(i0900_1000)
+	Tassert(t, err == nil, "Delete() failed: %v", err)
+	err = tx.Add(i0900_1000)
+	Tassert(t, err == nil, "Add() failed: %v", err)
+	i1100_1200 := db.Tadd(tx, 20, "2024-01-01T11:00:00", "2024-01-01T12:00:00", 3.0)
+	err = tx.Commit()
+	Tassert(t, err == nil, "Commit() failed: %v", err)
+	err = bdb.Close()
+	Tassert(t, err == nil, "Close() failed: %v", err)
+
+	// reopen the database and check that the intervals survived
+	bdb, err = NewBolt(path, nil)
+	Tassert(t, err == nil, "NewBolt() failed: %v", err)
+	defer bdb.Close()
+	tx = bdb.NewTx(false)
+	defer tx.Abort()
+	start, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T09:00:00")
+	Ck(err)
+	end, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T12:00:00")
+	Ck(err)
+	ivs, err := tx.FindFwd(start, end, 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	Tassert(t, len(ivs) == 3, "FindFwd() failed: expected 3 intervals, got %v", spew.Sdump(ivs))
+	Tassert(t, ivs[0].Id == 10 && i0900_1000.Equal(ivs[0]), "expected interval %v, got %v", i0900_1000, ivs[0])
+	Tassert(t, ivs[0].Payload == "standup", "expected payload %q, got %v", "standup", ivs[0].Payload)
+	Tassert(t, ivs[1].Id == 0 && ivs[1].Priority == 0, "expected free interval, got %v", ivs[1])
+	Tassert(t, ivs[2].Id == 20 && i1100_1200.Equal(ivs[2]), "expected interval %v, got %v", i1100_1200, ivs[2])
+	Tassert(t, ivs[2].Payload == nil, "expected nil payload, got %v", ivs[2].Payload)
+}
@@ -0,0 +1,90 @@
+package bolt
+
+import (
+	"bytes"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+	"github.com/stevegt/timectl/v3/db"
+	"github.com/stevegt/timectl/v3/interval"
+	"go.etcd.io/bbolt"
+)
+
+// NewFindIterator creates a new db.FindIterator that reads the
+// intervals on the given resource from the resource_start and
+// resource_end index buckets of the bbolt database.
+func NewFindIterator(tx *BoltTx, resource string, fwd bool, minStart, maxEnd time.Time, maxPriority float64) *db.FindIterator {
+	prefix := resourceKey(resource)
+	var boundsIter *cursorIterator
+	if fwd {
+		// first interval that ends on or after minStart
+		boundsIter = &cursorIterator{
+			tx:     tx,
+			cursor: tx.tx.Bucket(resourceEndBucket).Cursor(),
+			prefix: prefix,
+			seek:   resourceIndexKey(resource, timeKey(minStart)),
+			fwd:    true,
+		}
+	} else {
+		// last interval that starts before maxEnd
+		boundsIter = &cursorIterator{
+			tx:     tx,
+			cursor: tx.tx.Bucket(resourceStartBucket).Cursor(),
+			prefix: prefix,
+			seek:   resourceIndexKey(resource, timeKey(maxEnd)),
+			fwd:    false,
+		}
+	}
+	return db.NewFindIterator(boundsIter, fwd, minStart, maxEnd, maxPriority)
+}
+
+// cursorIterator iterates over an index bucket, returning the
+// intervals the index keys refer to.  If seek is nil, the iteration
+// starts at the first key (forward) or the last key (reverse).  If
+// prefix is not nil, the iteration stops at the first key without
+// it.
+type cursorIterator struct {
+	tx     *BoltTx
+	cursor *bbolt.Cursor
+	prefix []byte
+	seek   []byte
+	fwd    bool
+	sought bool
+}
+
+// Next returns the next interval, or nil if there are no more.
+func (c *cursorIterator) Next() *interval.Interval {
+	var key []byte
+	switch {
+	case !c.sought && c.seek == nil && c.fwd:
+		key, _ = c.cursor.First()
+	case !c.sought && c.seek == nil && !c.fwd:
+		key, _ = c.cursor.Last()
+	case !c.sought && c.fwd:
+		// first key on or after the seek key
+		key, _ = c.cursor.Seek(c.seek)
+	case !c.sought && !c.fwd:
+		// last key before the seek key
+		key, _ = c.cursor.Seek(c.seek)
+		if key == nil {
+			key, _ = c.cursor.Last()
+		} else {
+			key, _ = c.cursor.Prev()
+		}
+	case c.fwd:
+		key, _ = c.cursor.Next()
+	default:
+		key, _ = c.cursor.Prev()
+	}
+	c.sought = true
+	if key == nil || !bytes.HasPrefix(key, c.prefix) {
+		return nil
+	}
+
+	// db.Iterator has no way to return an error, so a missing or
+	// undecodable interval means the file is corrupt
+	iv, err := c.tx.get(keyId(key))
+	Ck(err)
+	Assert(iv != nil, "index refers to missing interval %d", keyId(key))
+	return iv
+}
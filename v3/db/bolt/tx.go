@@ -0,0 +1,326 @@
+package bolt
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+	"github.com/stevegt/timectl/v3/db"
+	"github.com/stevegt/timectl/v3/interval"
+	"go.etcd.io/bbolt"
+)
+
+// BoltTx must satisfy the db.Tx interface.
+var _ db.Tx = (*BoltTx)(nil)
+
+// BoltTx is a transaction for the bbolt database.
+type BoltTx struct {
+	tx    *bbolt.Tx
+	codec db.Codec
+	// err is the error, if any, from starting the transaction.  It
+	// is returned by every method.
+	err error
+}
+
+// Add adds an interval to the database.  If there is already an
+// interval with the same id, it returns an error wrapping
+// db.ErrExists.  If the interval is busy and conflicts with any
+// existing busy intervals, it returns a *db.ConflictError listing
+// them.
+func (tx *BoltTx) Add(iv *interval.Interval) (err error) {
+	defer Return(&err)
+	Ck(tx.err)
+	old, err := tx.get(iv.Id)
+	Ck(err)
+	if old != nil {
+		return fmt.Errorf("interval %d: %w", iv.Id, db.ErrExists)
+	}
+	err = tx.checkConflicts(iv)
+	Ck(err)
+	return tx.put(iv)
+}
+
+// Update replaces the stored interval that has the same id as iv
+// with iv.  If no interval has that id, or iv does not end after it
+// starts, it returns an error.  If iv is busy and conflicts with any
+// other existing busy interval, it returns a *db.ConflictError.
+func (tx *BoltTx) Update(iv *interval.Interval) (err error) {
+	defer Return(&err)
+	Ck(tx.err)
+	old, err := tx.get(iv.Id)
+	Ck(err)
+	if old == nil {
+		return fmt.Errorf("interval %d: %w", iv.Id, db.ErrNotFound)
+	}
+	if !iv.End.After(iv.Start) {
+		return fmt.Errorf("interval %d: end %v is not after start %v", iv.Id, iv.End, iv.Start)
+	}
+	err = tx.checkConflicts(iv)
+	Ck(err)
+	return tx.put(iv)
+}
+
+// Move changes the start and end time of the interval with the given
+// id.  It fails in the same way as Update.
+func (tx *BoltTx) Move(id uint64, start, end time.Time) (err error) {
+	defer Return(&err)
+	iv, err := tx.Get(id)
+	Ck(err)
+	if !end.After(start) {
+		return fmt.Errorf("interval %d: end %v is not after start %v", id, end, start)
+	}
+	iv.Start = start
+	iv.End = end
+	return tx.Update(iv)
+}
+
+// SetPriority sets the priority of the interval with the given id.
+// It fails in the same way as Update.
+func (tx *BoltTx) SetPriority(id uint64, priority float64) (err error) {
+	defer Return(&err)
+	iv, err := tx.Get(id)
+	Ck(err)
+	iv.Priority = priority
+	return tx.Update(iv)
+}
+
+// Get returns the interval with the given id.  If there is no such
+// interval, it returns an error wrapping db.ErrNotFound.
+func (tx *BoltTx) Get(id uint64) (iv *interval.Interval, err error) {
+	defer Return(&err)
+	Ck(tx.err)
+	iv, err = tx.get(id)
+	Ck(err)
+	if iv == nil {
+		return nil, fmt.Errorf("interval %d: %w", id, db.ErrNotFound)
+	}
+	return
+}
+
+// checkConflicts returns a *db.ConflictError if iv is busy and
+// conflicts with any existing busy intervals.
+func (tx *BoltTx) checkConflicts(iv *interval.Interval) (err error) {
+	defer Return(&err)
+	if !iv.Busy() {
+		return
+	}
+	conflicts, err := db.FindConflicts(tx, iv)
+	Ck(err)
+	if len(conflicts) > 0 {
+		return &db.ConflictError{Interval: iv, Conflicts: conflicts}
+	}
+	return
+}
+
+// put stores an interval and its index entries, replacing any
+// existing interval with the same id.
+func (tx *BoltTx) put(iv *interval.Interval) (err error) {
+	defer Return(&err)
+
+	old, err := tx.get(iv.Id)
+	Ck(err)
+	if old != nil {
+		err = tx.unindex(old)
+		Ck(err)
+	}
+
+	buf, err := db.EncodeInterval(iv, tx.codec)
+	Ck(err)
+	err = tx.tx.Bucket(intervalBucket).Put(idKey(iv.Id), buf)
+	Ck(err)
+	err = tx.tx.Bucket(startBucket).Put(indexKey(timeKey(iv.Start), iv.Id), nil)
+	Ck(err)
+	err = tx.tx.Bucket(endBucket).Put(indexKey(timeKey(iv.End), iv.Id), nil)
+	Ck(err)
+	err = tx.tx.Bucket(priorityBucket).Put(indexKey(floatKey(iv.Priority), iv.Id), nil)
+	Ck(err)
+	err = tx.tx.Bucket(resourceStartBucket).Put(resourceIndexKey(iv.Resource, indexKey(timeKey(iv.Start), iv.Id)), nil)
+	Ck(err)
+	err = tx.tx.Bucket(resourceEndBucket).Put(resourceIndexKey(iv.Resource, indexKey(timeKey(iv.End), iv.Id)), nil)
+	Ck(err)
+	return
+}
+
+// unindex removes the index entries for an interval.
+func (tx *BoltTx) unindex(iv *interval.Interval) (err error) {
+	defer Return(&err)
+	err = tx.tx.Bucket(startBucket).Delete(indexKey(timeKey(iv.Start), iv.Id))
+	Ck(err)
+	err = tx.tx.Bucket(endBucket).Delete(indexKey(timeKey(iv.End), iv.Id))
+	Ck(err)
+	err = tx.tx.Bucket(priorityBucket).Delete(indexKey(floatKey(iv.Priority), iv.Id))
+	Ck(err)
+	err = tx.tx.Bucket(resourceStartBucket).Delete(resourceIndexKey(iv.Resource, indexKey(timeKey(iv.Start), iv.Id)))
+	Ck(err)
+	err = tx.tx.Bucket(resourceEndBucket).Delete(resourceIndexKey(iv.Resource, indexKey(timeKey(iv.End), iv.Id)))
+	Ck(err)
+	return
+}
+
+// get returns the stored interval with the given id, or nil if there
+// is none.
+func (tx *BoltTx) get(id uint64) (iv *interval.Interval, err error) {
+	buf := tx.tx.Bucket(intervalBucket).Get(idKey(id))
+	if buf == nil {
+		return nil, nil
+	}
+	return db.DecodeInterval(buf, tx.codec)
+}
+
+// FindFwdIter returns an iterator for the intervals on the default
+// resource that intersect with the given start and end time and are
+// at or lower than the given priority.  The results are sorted in
+// ascending order by end time.  The results include synthetic free
+// intervals that represent the time slots between the intervals.
+func (tx *BoltTx) FindFwdIter(minStart, maxEnd time.Time, maxPriority float64) (iter db.Iterator, err error) {
+	return tx.FindFwdIterIn("", minStart, maxEnd, maxPriority)
+}
+
+// FindRevIter is the same as FindFwdIter, but it returns the results
+// in descending order by start time.
+func (tx *BoltTx) FindRevIter(minStart, maxEnd time.Time, maxPriority float64) (iter db.Iterator, err error) {
+	return tx.FindRevIterIn("", minStart, maxEnd, maxPriority)
+}
+
+// FindFwdIterIn is the same as FindFwdIter, but it searches the given
+// resource.
+func (tx *BoltTx) FindFwdIterIn(resource string, minStart, maxEnd time.Time, maxPriority float64) (iter db.Iterator, err error) {
+	if tx.err != nil {
+		return nil, tx.err
+	}
+	return NewFindIterator(tx, resource, true, minStart, maxEnd, maxPriority), nil
+}
+
+// FindRevIterIn is the same as FindRevIter, but it searches the given
+// resource.
+func (tx *BoltTx) FindRevIterIn(resource string, minStart, maxEnd time.Time, maxPriority float64) (iter db.Iterator, err error) {
+	if tx.err != nil {
+		return nil, tx.err
+	}
+	return NewFindIterator(tx, resource, false, minStart, maxEnd, maxPriority), nil
+}
+
+// FindFwd is a convenience method that returns the results of
+// FindFwdIter as a slice.
+func (tx *BoltTx) FindFwd(minStart, maxEnd time.Time, maxPriority float64) (ivs []*interval.Interval, err error) {
+	defer Return(&err)
+	iter, err := tx.FindFwdIter(minStart, maxEnd, maxPriority)
+	Ck(err)
+	for {
+		iv := iter.Next()
+		if iv == nil {
+			break
+		}
+		ivs = append(ivs, iv)
+	}
+	return
+}
+
+// FindRev is a convenience method that returns the results of
+// FindRevIter as a slice.
+func (tx *BoltTx) FindRev(minStart, maxEnd time.Time, maxPriority float64) (ivs []*interval.Interval, err error) {
+	defer Return(&err)
+	iter, err := tx.FindRevIter(minStart, maxEnd, maxPriority)
+	Ck(err)
+	for {
+		iv := iter.Next()
+		if iv == nil {
+			break
+		}
+		ivs = append(ivs, iv)
+	}
+	return
+}
+
+// At returns the intervals on the default resource that contain the
+// given time, or a synthetic free interval if there are none.
+func (tx *BoltTx) At(t time.Time) (ivs []*interval.Interval, err error) {
+	return db.AtIn(tx, "", t)
+}
+
+// Next returns the first busy interval on the default resource that
+// starts after the given time, or nil if there is none.
+func (tx *BoltTx) Next(t time.Time) (iv *interval.Interval, err error) {
+	return db.NextIn(tx, "", t)
+}
+
+// Prev returns the last busy interval on the default resource that
+// ends on or before the given time, or nil if there is none.
+func (tx *BoltTx) Prev(t time.Time) (iv *interval.Interval, err error) {
+	return db.PrevIn(tx, "", t)
+}
+
+// IterateDown returns an iterator over all intervals in descending
+// order of priority.
+func (tx *BoltTx) IterateDown() (iter db.Iterator, err error) {
+	return tx.iterate(priorityBucket, false)
+}
+
+// IterateUp returns an iterator over all intervals in ascending order
+// of priority.
+func (tx *BoltTx) IterateUp() (iter db.Iterator, err error) {
+	return tx.iterate(priorityBucket, true)
+}
+
+// IterateForward returns an iterator over all intervals in ascending
+// order of start time.
+func (tx *BoltTx) IterateForward() (iter db.Iterator, err error) {
+	return tx.iterate(startBucket, true)
+}
+
+// IterateBackward returns an iterator over all intervals in
+// descending order of start time.
+func (tx *BoltTx) IterateBackward() (iter db.Iterator, err error) {
+	return tx.iterate(startBucket, false)
+}
+
+// iterate returns an iterator over all intervals in the order of the
+// given index bucket, reversed if fwd is false.
+func (tx *BoltTx) iterate(bucket []byte, fwd bool) (iter db.Iterator, err error) {
+	if tx.err != nil {
+		return nil, tx.err
+	}
+	return &cursorIterator{tx: tx, cursor: tx.tx.Bucket(bucket).Cursor(), fwd: fwd}, nil
+}
+
+// Delete removes an interval from the database.  If the interval
+// does not exist, it returns an error wrapping db.ErrNotFound.
+func (tx *BoltTx) Delete(iv *interval.Interval) (err error) {
+	return tx.DeleteById(iv.Id)
+}
+
+// DeleteById removes the interval with the given id from the
+// database.  If there is no such interval, it returns an error
+// wrapping db.ErrNotFound.
+func (tx *BoltTx) DeleteById(id uint64) (err error) {
+	defer Return(&err)
+	old, err := tx.Get(id)
+	Ck(err)
+	err = tx.unindex(old)
+	Ck(err)
+	err = tx.tx.Bucket(intervalBucket).Delete(idKey(id))
+	Ck(err)
+	return
+}
+
+// Commit commits the transaction.  For a write transaction, the
+// changes are synced to disk before Commit returns.
+func (tx *BoltTx) Commit() error {
+	if tx.err != nil {
+		return tx.err
+	}
+	if !tx.tx.Writable() {
+		return tx.tx.Rollback()
+	}
+	return tx.tx.Commit()
+}
+
+// Abort aborts the transaction.
+func (tx *BoltTx) Abort() {
+	if tx.err != nil {
+		return
+	}
+	// Rollback returns an error if the transaction has already been
+	// committed or aborted, which is harmless here.
+	_ = tx.tx.Rollback()
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"bytes"
+	"encoding/gob"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+	"github.com/stevegt/timectl/v3/interval"
+)
+
+// Codec encodes and decodes interval payloads for backends that
+// serialize intervals.
+type Codec interface {
+	// Encode returns the serialized form of payload.
+	Encode(payload any) ([]byte, error)
+
+	// Decode returns the payload serialized in buf.
+	Decode(buf []byte) (any, error)
+}
+
+// GobCodec is a Codec that uses encoding/gob.  As with any gob-encoded
+// interface value, the concrete payload types must be registered with
+// gob.Register before they are encoded or decoded.
+type GobCodec struct{}
+
+// Encode satisfies the Codec interface.  A nil payload is encoded as
+// an empty buffer.
+func (GobCodec) Encode(payload any) (buf []byte, err error) {
+	defer Return(&err)
+	if payload == nil {
+		return nil, nil
+	}
+	var b bytes.Buffer
+	err = gob.NewEncoder(&b).Encode(&payload)
+	Ck(err)
+	return b.Bytes(), nil
+}
+
+// Decode satisfies the Codec interface.
+func (GobCodec) Decode(buf []byte) (payload any, err error) {
+	defer Return(&err)
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	err = gob.NewDecoder(bytes.NewReader(buf)).Decode(&payload)
+	Ck(err)
+	return
+}
+
+// record is the serialized form of an interval.
+type record struct {
+	Id       uint64
+	Start    time.Time
+	End      time.Time
+	Priority float64
+	Payload  []byte
+	Resource string
+}
+
+// EncodeInterval serializes an interval, using codec to encode the
+// payload.
+func EncodeInterval(iv *interval.Interval, codec Codec) (buf []byte, err error) {
+	defer Return(&err)
+	payload, err := codec.Encode(iv.Payload)
+	Ck(err)
+	rec := record{
+		Id:       iv.Id,
+		Start:    iv.Start,
+		End:      iv.End,
+		Priority: iv.Priority,
+		Payload:  payload,
+		Resource: iv.Resource,
+	}
+	var b bytes.Buffer
+	err = gob.NewEncoder(&b).Encode(&rec)
+	Ck(err)
+	return b.Bytes(), nil
+}
+
+// DecodeInterval deserializes an interval encoded by EncodeInterval,
+// using codec to decode the payload.
+func DecodeInterval(buf []byte, codec Codec) (iv *interval.Interval, err error) {
+	defer Return(&err)
+	var rec record
+	err = gob.NewDecoder(bytes.NewReader(buf)).Decode(&rec)
+	Ck(err)
+	payload, err := codec.Decode(rec.Payload)
+	Ck(err)
+	iv = &interval.Interval{
+		Id:       rec.Id,
+		Start:    rec.Start,
+		End:      rec.End,
+		Priority: rec.Priority,
+		Payload:  payload,
+		Resource: rec.Resource,
+	}
+	return
+}
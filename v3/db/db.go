@@ -20,29 +20,64 @@ type Db interface {
 
 // Tx is an interface for a database transaction.  It provides
 // methods for adding, changing, deleting, and querying intervals.
+//
+// A database can hold the calendars of many resources -- people,
+// rooms, and so on -- distinguished by the Resource field of each
+// interval.  Ids are unique across all resources.  The Find* methods
+// search the default resource, named by the empty string, and the
+// Find*In methods search a given resource; see also Scope.
 type Tx interface {
 
 	// Commit commits the transaction.  If the transaction is a write
-	// transaction, it writes the changes to the database.
-	Commit()
+	// transaction, it writes the changes to the database.  If the
+	// database is persistent, the changes are durable when Commit
+	// returns without error.
+	Commit() error
 
 	// Abort aborts the transaction.  If the transaction is a write
 	// transaction, it discards the changes.  If the transaction is a
 	// read transaction, it releases the resources.
 	Abort()
 
-	// Add adds an interval to the database.  If the interval
-	// conflicts with an existing interval, it returns an error.
+	// Add adds an interval to the database.  If there is already an
+	// interval with the same id, it returns an error wrapping
+	// ErrExists.  If the interval conflicts with an existing interval
+	// on the same resource, it returns a *ConflictError.
 	Add(iv *interval.Interval) error
 
-	// SetPriority sets the priority of an interval in the database.  If
-	// the interval does not exist, it returns an error.
-	// SetPriority(iv interval.Interval, priority float64) error
+	// Get returns the interval with the given id.  The result is a
+	// copy; changing it does not change the database until it is
+	// passed to Update.  If there is no interval with the given id,
+	// it returns an error wrapping ErrNotFound.
+	Get(id uint64) (*interval.Interval, error)
+
+	// Update replaces the stored interval that has the same id as iv
+	// with iv, re-indexing it.  If no interval has that id, it
+	// returns an error wrapping ErrNotFound.  If iv conflicts with
+	// any other existing interval, it returns a *ConflictError and
+	// leaves the stored interval unchanged.  If iv does not end after
+	// it starts, it returns an error.
+	Update(iv *interval.Interval) error
+
+	// Move changes the start and end time of the interval with the
+	// given id, keeping its id, priority, and payload.  It fails in
+	// the same way as Update.
+	Move(id uint64, start, end time.Time) error
+
+	// SetPriority sets the priority of the interval with the given
+	// id.  It fails in the same way as Update.
+	SetPriority(id uint64, priority float64) error
 
 	// Delete deletes an interval from the database.  If the
-	// interval does not exist, it returns an error.
+	// interval does not exist, it returns an error wrapping
+	// ErrNotFound.
 	Delete(iv *interval.Interval) error
 
+	// DeleteById deletes the interval with the given id from the
+	// database.  If there is no such interval, it returns an error
+	// wrapping ErrNotFound.
+	DeleteById(id uint64) error
+
 	// FindFwd is a convenience method that returns the results of
 	// FindFwdIter as a slice.
 	FindFwd(minStart, maxEnd time.Time, maxPriority float64) ([]*interval.Interval, error)
@@ -51,7 +86,8 @@ type Tx interface {
 	// that intersect with the given start and end time and are lower
 	// than the given priority.  The results are ordered by ascending end
 	// time.  The results include synthetic free intervals that represent
-	// the time slots between the intervals.
+	// the time slots between the intervals, including any free time at
+	// the start or end of the range.
 	FindFwdIter(minStart, maxEnd time.Time, maxPriority float64) (Iterator, error)
 
 	// FindRev is a convenience method that returns the results of
@@ -62,13 +98,49 @@ type Tx interface {
 	// by descending start time.
 	FindRevIter(minStart, maxEnd time.Time, maxPriority float64) (Iterator, error)
 
+	// FindFwdIterIn is the same as FindFwdIter, but it searches the
+	// intervals on the given resource.
+	FindFwdIterIn(resource string, minStart, maxEnd time.Time, maxPriority float64) (Iterator, error)
+
+	// FindRevIterIn is the same as FindRevIter, but it searches the
+	// intervals on the given resource.
+	FindRevIterIn(resource string, minStart, maxEnd time.Time, maxPriority float64) (Iterator, error)
+
+	// At returns the intervals on the default resource that contain
+	// the given time, meaning that they start on or before it and end
+	// after it.  If no interval contains the time, it returns a single
+	// synthetic free interval that covers it, reaching back to the
+	// end of the previous busy interval and forward to the start of
+	// the next one, or to util.EarliestTime and util.LatestTime if
+	// there are none.
+	At(t time.Time) ([]*interval.Interval, error)
+
+	// Next returns the first busy interval on the default resource
+	// that starts after the given time, or nil if there is none.
+	Next(t time.Time) (*interval.Interval, error)
+
+	// Prev returns the last busy interval on the default resource
+	// that ends on or before the given time, or nil if there is none.
+	Prev(t time.Time) (*interval.Interval, error)
+
 	// IterateDown returns an iterator that iterates over all intervals
-	// in the database in descending order of priority.
-	// IterateDown() Iterator
+	// in the database, on all resources, in descending order of
+	// priority.  The iterators returned by the Iterate* methods do
+	// not include synthetic free intervals, and the database must not
+	// be changed in the same transaction while they are in use.
+	IterateDown() (Iterator, error)
+
+	// IterateUp returns an iterator that iterates over all intervals
+	// in the database in ascending order of priority.
+	IterateUp() (Iterator, error)
 
 	// IterateForward returns an iterator that iterates over all intervals
 	// in the database in ascending order of start time.
-	// IterateForward() Iterator
+	IterateForward() (Iterator, error)
+
+	// IterateBackward returns an iterator that iterates over all
+	// intervals in the database in descending order of start time.
+	IterateBackward() (Iterator, error)
 }
 
 // Iterator is an interface for iterating over intervals in a database.
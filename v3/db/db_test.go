@@ -119,3 +119,402 @@ func ExampleConflicts() {
 	}
 
 }
+
+func ExamplePreempt() {
+	memdb, err := mem.NewMem()
+	Ck(err)
+	tx := memdb.NewTx(true)
+
+	db.Tadd(tx, 10, "2024-01-01T08:00:00", "2024-01-01T09:00:00", 1.0)
+	db.Tadd(tx, 20, "2024-01-01T09:00:00", "2024-01-01T10:00:00", 2.0)
+	db.Tadd(tx, 30, "2024-01-01T10:00:00", "2024-01-01T11:00:00", 1.0)
+	db.Tadd(tx, 40, "2024-01-01T11:00:00", "2024-01-01T12:00:00", 5.0)
+
+	// an urgent job from 08:30 to 10:30 at priority 3 displaces
+	// intervals 10, 20, and 30
+	start, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T08:30:00")
+	Ck(err)
+	end, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T10:30:00")
+	Ck(err)
+	urgent := interval.NewInterval(50, start, end, 3.0)
+	displaced, err := db.Preempt(tx, urgent, false)
+	Ck(err)
+	Pf("evicted:\n")
+	for _, iv := range displaced {
+		Pf("%v\n", iv)
+	}
+
+	// with trimming, intervals that stick out on one side keep the
+	// part that does not overlap
+	tx.Abort()
+	tx = memdb.NewTx(true)
+	db.Tadd(tx, 10, "2024-01-01T08:00:00", "2024-01-01T09:00:00", 1.0)
+	db.Tadd(tx, 20, "2024-01-01T09:00:00", "2024-01-01T10:00:00", 2.0)
+	db.Tadd(tx, 30, "2024-01-01T10:00:00", "2024-01-01T11:00:00", 1.0)
+	db.Tadd(tx, 40, "2024-01-01T11:00:00", "2024-01-01T12:00:00", 5.0)
+	displaced, err = db.Preempt(tx, urgent, true)
+	Ck(err)
+	Pf("\ntrimmed:\n")
+	for _, iv := range displaced {
+		Pf("%v\n", iv)
+	}
+	Pf("\nremaining:\n")
+	iter, err := tx.IterateForward()
+	Ck(err)
+	for iv := iter.Next(); iv != nil; iv = iter.Next() {
+		Pf("%v\n", iv)
+	}
+
+	// interval 40 has a higher priority, so it can't be displaced
+	start, err = time.Parse("2006-01-02T15:04:05", "2024-01-01T11:30:00")
+	Ck(err)
+	end, err = time.Parse("2006-01-02T15:04:05", "2024-01-01T12:30:00")
+	Ck(err)
+	_, err = db.Preempt(tx, interval.NewInterval(60, start, end, 3.0), true)
+	Pf("\n%v\n", err)
+
+	// Output:
+	// evicted:
+	// 10 2024-01-01T08:00:00Z - 2024-01-01T09:00:00Z 1
+	// 20 2024-01-01T09:00:00Z - 2024-01-01T10:00:00Z 2
+	// 30 2024-01-01T10:00:00Z - 2024-01-01T11:00:00Z 1
+	//
+	// trimmed:
+	// 10 2024-01-01T08:30:00Z - 2024-01-01T09:00:00Z 1
+	// 20 2024-01-01T09:00:00Z - 2024-01-01T10:00:00Z 2
+	// 30 2024-01-01T10:00:00Z - 2024-01-01T10:30:00Z 1
+	//
+	// remaining:
+	// 10 2024-01-01T08:00:00Z - 2024-01-01T08:30:00Z 1
+	// 50 2024-01-01T08:30:00Z - 2024-01-01T10:30:00Z 3
+	// 30 2024-01-01T10:30:00Z - 2024-01-01T11:00:00Z 1
+	// 40 2024-01-01T11:00:00Z - 2024-01-01T12:00:00Z 5
+	//
+	// interval 60 2024-01-01T11:30:00Z - 2024-01-01T12:30:00Z 3 conflicts with 40 2024-01-01T11:00:00Z - 2024-01-01T12:00:00Z 5
+}
+
+func ExampleReschedule() {
+	memdb, err := mem.NewMem()
+	Ck(err)
+	tx := memdb.NewTx(true)
+
+	db.Tadd(tx, 10, "2024-01-01T08:00:00", "2024-01-01T09:00:00", 3.0)
+	db.Tadd(tx, 20, "2024-01-01T09:30:00", "2024-01-01T10:00:00", 1.0)
+	db.Tadd(tx, 30, "2024-01-01T10:00:00", "2024-01-01T11:00:00", 3.0)
+	db.Tadd(tx, 40, "2024-01-01T12:00:00", "2024-01-01T13:00:00", 3.0)
+
+	// an urgent job evicts interval 10
+	start, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T08:00:00")
+	Ck(err)
+	end, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T09:00:00")
+	Ck(err)
+	displaced, err := db.Preempt(tx, interval.NewInterval(50, start, end, 9.0), false)
+	Ck(err)
+
+	// find interval 10 a new home before 13:00, allowing it to
+	// displace intervals up to priority 2 -- it displaces interval
+	// 20, which then only fits in the gap at 11:00
+	deadline, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T13:00:00")
+	Ck(err)
+	policy := db.ReschedulePolicy{Deadline: deadline, MaxPriority: 2.0}
+	placed, unplaced, err := db.Reschedule(tx, displaced, end, policy)
+	Ck(err)
+	Pf("placed:\n")
+	for _, iv := range placed {
+		Pf("%v\n", iv)
+	}
+	Pf("unplaced: %d\n", len(unplaced))
+
+	// there is no room left for another hour before the deadline
+	extra := interval.NewInterval(60, start, end, 1.0)
+	_, unplaced, err = db.Reschedule(tx, []*interval.Interval{extra}, end, policy)
+	Ck(err)
+	Pf("unplaced: %v\n", unplaced)
+
+	// each interval may only be given once
+	_, _, err = db.Reschedule(tx, []*interval.Interval{extra, extra}, end, policy)
+	Pf("%v\n", err)
+
+	// Output:
+	// placed:
+	// 10 2024-01-01T09:00:00Z - 2024-01-01T10:00:00Z 3
+	// 20 2024-01-01T11:00:00Z - 2024-01-01T11:30:00Z 1
+	// unplaced: 0
+	// unplaced: [60 2024-01-01T08:00:00Z - 2024-01-01T09:00:00Z 1]
+	// interval 60 is given more than once
+}
+
+func ExampleReschedule_displaced() {
+	memdb, err := mem.NewMem()
+	Ck(err)
+	tx := memdb.NewTx(true)
+
+	start, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T09:00:00")
+	Ck(err)
+	deadline, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T12:00:00")
+	Ck(err)
+	a := interval.NewInterval(1, start, start.Add(time.Hour), 2.0)
+	b := interval.NewInterval(2, start, start.Add(2*time.Hour), 5.0)
+
+	// interval 1 is placed at 9:00, then displaced by interval 2 and
+	// placed again at 11:00 -- only its final placement is returned
+	policy := db.ReschedulePolicy{Deadline: deadline, MaxPriority: 9.0}
+	placed, _, err := db.Reschedule(tx, []*interval.Interval{a, b}, start, policy)
+	Ck(err)
+	for _, iv := range placed {
+		stored, err := tx.Get(iv.Id)
+		Ck(err)
+		Pf("%v stored %v\n", iv, stored.Equal(iv))
+	}
+
+	// Output:
+	// 2 2024-01-01T09:00:00Z - 2024-01-01T11:00:00Z 5 stored true
+	// 1 2024-01-01T11:00:00Z - 2024-01-01T12:00:00Z 2 stored true
+}
+
+func ExampleFindSplitSet() {
+	memdb, err := mem.NewMem()
+	Ck(err)
+	tx := memdb.NewTx(true)
+
+	db.Tadd(tx, 10, "2024-01-01T08:00:00", "2024-01-01T09:00:00", 3.0)
+	// 15 minute gap
+	db.Tadd(tx, 20, "2024-01-01T09:15:00", "2024-01-01T10:00:00", 3.0)
+	// 45 minute gap
+	db.Tadd(tx, 30, "2024-01-01T10:45:00", "2024-01-01T12:00:00", 3.0)
+	// 30 minute gap
+	db.Tadd(tx, 40, "2024-01-01T12:30:00", "2024-01-01T13:00:00", 1.0)
+	db.Tadd(tx, 50, "2024-01-01T13:00:00", "2024-01-01T13:30:00", 1.0)
+	db.Tadd(tx, 60, "2024-01-01T13:30:00", "2024-01-01T15:00:00", 3.0)
+
+	// find 90 minutes of time with priority 1 or less, split into
+	// at most 2 chunks of at least 30 minutes each -- the 15 minute
+	// gap is too short to use
+	start, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T08:00:00")
+	Ck(err)
+	end, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T15:00:00")
+	Ck(err)
+	chunks, err := db.FindSplitSet(tx, true, start, end, 90*time.Minute, 1.0, 30*time.Minute, 2)
+	Ck(err)
+	for i, chunk := range chunks {
+		Pf("chunk %d:\n", i)
+		for _, iv := range chunk {
+			Pf("%v\n", iv)
+		}
+	}
+
+	// if the work can't be split, the whole 90 minutes have to be
+	// contiguous
+	chunks, err = db.FindSplitSet(tx, true, start, end, 90*time.Minute, 1.0, 30*time.Minute, 1)
+	Ck(err)
+	for i, chunk := range chunks {
+		Pf("chunk %d:\n", i)
+		for _, iv := range chunk {
+			Pf("%v\n", iv)
+		}
+	}
+
+	// Output:
+	// chunk 0:
+	// 0 2024-01-01T10:00:00Z - 2024-01-01T10:45:00Z 0
+	// chunk 1:
+	// 0 2024-01-01T12:00:00Z - 2024-01-01T12:30:00Z 0
+	// 40 2024-01-01T12:30:00Z - 2024-01-01T13:00:00Z 1
+	// chunk 0:
+	// 0 2024-01-01T12:00:00Z - 2024-01-01T12:30:00Z 0
+	// 40 2024-01-01T12:30:00Z - 2024-01-01T13:00:00Z 1
+	// 50 2024-01-01T13:00:00Z - 2024-01-01T13:30:00Z 1
+}
+
+func ExampleFindSets() {
+	memdb, err := mem.NewMem()
+	Ck(err)
+	tx := memdb.NewTx(true)
+
+	db.Tadd(tx, 10, "2024-01-01T08:00:00", "2024-01-01T09:00:00", 3.0)
+	// 30 minute gap
+	db.Tadd(tx, 20, "2024-01-01T09:30:00", "2024-01-01T10:00:00", 1.0)
+	db.Tadd(tx, 30, "2024-01-01T10:00:00", "2024-01-01T11:00:00", 3.0)
+	// 90 minute gap
+	db.Tadd(tx, 40, "2024-01-01T12:30:00", "2024-01-01T13:00:00", 1.0)
+	db.Tadd(tx, 50, "2024-01-01T13:00:00", "2024-01-01T15:00:00", 3.0)
+
+	start, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T08:00:00")
+	Ck(err)
+	end, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T15:00:00")
+	Ck(err)
+	noon, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T12:00:00")
+	Ck(err)
+
+	// rank the places an hour-long job could go, displacing nothing
+	// above priority 1
+	for _, score := range []struct {
+		name string
+		fn   db.ScoreFunc
+	}{
+		{"least preemption", db.PreemptionCost},
+		{"tightest fit", db.TightestFit},
+		{"earliest end", db.EarliestEnd},
+		{"closest to noon", db.ClosestTo(noon)},
+	} {
+		candidates, err := db.FindSets(tx, start, end, time.Hour, 1.0, score.fn, 0)
+		Ck(err)
+		Pf("%s:\n", score.name)
+		for _, c := range candidates {
+			Pf("  %s - %s score %.0f\n", c.Start.Format("15:04"), c.End.Format("15:04"), c.Score)
+		}
+	}
+
+	// Output:
+	// least preemption:
+	//   11:00 - 12:30 score 0
+	//   09:00 - 10:00 score 1
+	// tightest fit:
+	//   09:00 - 10:00 score 0
+	//   11:00 - 12:30 score 1800
+	// earliest end:
+	//   09:00 - 10:00 score 1704103200
+	//   11:00 - 12:30 score 1704110400
+	// closest to noon:
+	//   11:00 - 12:30 score 1800
+	//   09:00 - 10:00 score 10800
+}
+
+func ExampleFindCommonSet() {
+	memdb, err := mem.NewMem()
+	Ck(err)
+	tx := memdb.NewTx(true)
+
+	alice := db.Scope(tx, "alice")
+	bob := db.Scope(tx, "bob")
+	room := db.Scope(tx, "room3")
+	db.Tadd(alice, 10, "2024-01-01T09:00:00", "2024-01-01T10:00:00", 3.0)
+	db.Tadd(alice, 20, "2024-01-01T11:00:00", "2024-01-01T12:00:00", 1.0)
+	db.Tadd(bob, 30, "2024-01-01T10:00:00", "2024-01-01T11:00:00", 3.0)
+	db.Tadd(room, 40, "2024-01-01T12:00:00", "2024-01-01T13:00:00", 3.0)
+
+	start, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T09:00:00")
+	Ck(err)
+	end, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T17:00:00")
+	Ck(err)
+	resources := []string{"alice", "bob", "room3"}
+
+	// when are all three free for 45 minutes?
+	common, err := db.FindCommonSet(tx, resources, true, start, end, 45*time.Minute, 0)
+	Ck(err)
+	Pf("first free: %s - %s\n", common.Start.Format("15:04"), common.End.Format("15:04"))
+	common, err = db.FindCommonSet(tx, resources, false, start, end, 45*time.Minute, 0)
+	Ck(err)
+	Pf("last free: %s - %s\n", common.Start.Format("15:04"), common.End.Format("15:04"))
+
+	// if alice's priority 1 meeting can be bumped, there is an
+	// earlier slot
+	common, err = db.FindCommonSet(tx, resources, true, start, end, 45*time.Minute, 1.0)
+	Ck(err)
+	Pf("first with preemption: %s - %s\n", common.Start.Format("15:04"), common.End.Format("15:04"))
+	for _, resource := range resources {
+		Pf("%s: %v\n", resource, common.Sets[resource])
+	}
+
+	// Output:
+	// first free: 13:00 - 13:45
+	// last free: 16:15 - 17:00
+	// first with preemption: 11:00 - 11:45
+	// alice: [20 2024-01-01T11:00:00Z - 2024-01-01T12:00:00Z 1]
+	// bob: [0 2024-01-01T11:00:00Z - 2024-01-01T11:45:00Z 0]
+	// room3: [0 2024-01-01T11:00:00Z - 2024-01-01T11:45:00Z 0]
+}
+
+func ExampleFindQuorum() {
+	memdb, err := mem.NewMem()
+	Ck(err)
+	tx := memdb.NewTx(true)
+
+	db.Tadd(db.Scope(tx, "ann"), 10, "2024-01-01T09:00:00", "2024-01-01T10:00:00", 2.0)
+	db.Tadd(db.Scope(tx, "ben"), 20, "2024-01-01T10:00:00", "2024-01-01T11:00:00", 2.0)
+	db.Tadd(db.Scope(tx, "cal"), 30, "2024-01-01T11:00:00", "2024-01-01T12:00:00", 2.0)
+
+	start, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T09:00:00")
+	Ck(err)
+	end, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T12:00:00")
+	Ck(err)
+	reviewers := []string{"ann", "ben", "cal", "dee"}
+
+	// when are at least 3 of the 4 reviewers free for an hour?
+	slots, err := db.FindQuorum(tx, reviewers, 3, start, end, time.Hour, 0)
+	Ck(err)
+	for _, slot := range slots {
+		Pf("%s - %s %v\n", slot.Start.Format("15:04"), slot.End.Format("15:04"), slot.Available)
+	}
+
+	// all 4 are never free at the same time
+	slots, err = db.FindQuorum(tx, reviewers, 4, start, end, time.Hour, 0)
+	Ck(err)
+	Pf("%d slots\n", len(slots))
+
+	// Output:
+	// 09:00 - 10:00 [ben cal dee]
+	// 10:00 - 11:00 [ann cal dee]
+	// 11:00 - 12:00 [ann ben dee]
+	// 0 slots
+}
+
+func ExampleFindPoolSet() {
+	memdb, err := mem.NewMem()
+	Ck(err)
+	tx := memdb.NewTx(true)
+
+	// a lab with 2 benches
+	lab := db.Pool{Name: "lab", Capacity: 2}
+	for i, times := range [][]string{
+		{"2024-01-01T09:00:00", "2024-01-01T11:00:00"},
+		{"2024-01-01T10:00:00", "2024-01-01T12:00:00"},
+		{"2024-01-01T11:00:00", "2024-01-01T13:00:00"},
+		// the lab is full from 10:00 to 11:00, so this doesn't fit
+		{"2024-01-01T10:00:00", "2024-01-01T10:30:00"},
+	} {
+		start, err := time.Parse("2006-01-02T15:04:05", times[0])
+		Ck(err)
+		end, err := time.Parse("2006-01-02T15:04:05", times[1])
+		Ck(err)
+		iv := interval.NewInterval(uint64(i+1), start, end, 1.0)
+		err = db.AddToPool(tx, lab, iv)
+		if err != nil {
+			Pf("interval %d: %v\n", iv.Id, err)
+			continue
+		}
+		Pf("interval %d on %s\n", iv.Id, iv.Resource)
+	}
+
+	start, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T08:00:00")
+	Ck(err)
+	end, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T14:00:00")
+	Ck(err)
+	segments, err := db.FreeCapacity(tx, lab, start, end, 0)
+	Ck(err)
+	for _, seg := range segments {
+		Pf("%s - %s free %d\n", seg.Start.Format("15:04"), seg.End.Format("15:04"), seg.Free)
+	}
+
+	// the first hour with both benches free
+	slot, err := db.FindPoolSet(tx, lab, 2, true, start, end, time.Hour, 0)
+	Ck(err)
+	Pf("first: %s - %s free %d\n", slot.Start.Format("15:04"), slot.End.Format("15:04"), slot.Free)
+	// the last 90 minutes with one bench free
+	slot, err = db.FindPoolSet(tx, lab, 1, false, start, end, 90*time.Minute, 0)
+	Ck(err)
+	Pf("last: %s - %s free %d\n", slot.Start.Format("15:04"), slot.End.Format("15:04"), slot.Free)
+
+	// Output:
+	// interval 1 on lab/0
+	// interval 2 on lab/1
+	// interval 3 on lab/0
+	// interval 4: interval 4 2024-01-01T10:00:00Z - 2024-01-01T10:30:00Z 1 conflicts with 1 2024-01-01T09:00:00Z - 2024-01-01T11:00:00Z 1, 2 2024-01-01T10:00:00Z - 2024-01-01T12:00:00Z 1
+	// 08:00 - 09:00 free 2
+	// 09:00 - 10:00 free 1
+	// 10:00 - 12:00 free 0
+	// 12:00 - 13:00 free 1
+	// 13:00 - 14:00 free 2
+	// first: 08:00 - 09:00 free 2
+	// last: 12:30 - 14:00 free 1
+}
@@ -0,0 +1,979 @@
+// Package dbtest provides a conformance test suite for implementations
+// of the db.Db and db.Tx interfaces.  A backend runs the suite from its
+// own tests by calling Run with a factory that opens an empty
+// database.
+package dbtest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/davecgh/go-spew/spew"
+	. "github.com/stevegt/goadapt"
+	"github.com/stevegt/timectl/v3/db"
+	"github.com/stevegt/timectl/v3/interval"
+	"github.com/stevegt/timectl/v3/util"
+)
+
+// Factory returns a new, empty database.  Run calls it once for
+// each test in the suite and closes the database when the test is
+// done.
+type Factory func() (db.Db, error)
+
+// Run runs the conformance test suite against databases returned by
+// factory.
+func Run(t *testing.T, factory Factory) {
+	t.Run("AddFind", func(t *testing.T) { testAddFind(t, factory) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, factory) })
+	t.Run("Conflict", func(t *testing.T) { testConflict(t, factory) })
+	t.Run("Get", func(t *testing.T) { testGet(t, factory) })
+	t.Run("DeleteById", func(t *testing.T) { testDeleteById(t, factory) })
+	t.Run("Update", func(t *testing.T) { testUpdate(t, factory) })
+	t.Run("Move", func(t *testing.T) { testMove(t, factory) })
+	t.Run("SetPriority", func(t *testing.T) { testSetPriority(t, factory) })
+	t.Run("Iterate", func(t *testing.T) { testIterate(t, factory) })
+	t.Run("FindOrder", func(t *testing.T) { testFindOrder(t, factory) })
+	t.Run("FindPriority", func(t *testing.T) { testFindPriority(t, factory) })
+	t.Run("FreeIntervals", func(t *testing.T) { testFreeIntervals(t, factory) })
+	t.Run("EdgeFreeIntervals", func(t *testing.T) { testEdgeFreeIntervals(t, factory) })
+	t.Run("FindSet", func(t *testing.T) { testFindSet(t, factory) })
+	t.Run("FindFree", func(t *testing.T) { testFindFree(t, factory) })
+	t.Run("Clip", func(t *testing.T) { testClip(t, factory) })
+	t.Run("Resources", func(t *testing.T) { testResources(t, factory) })
+	t.Run("AtNextPrev", func(t *testing.T) { testAtNextPrev(t, factory) })
+	t.Run("Pool", func(t *testing.T) { testPool(t, factory) })
+	t.Run("Commit", func(t *testing.T) { testCommit(t, factory) })
+	t.Run("Abort", func(t *testing.T) { testAbort(t, factory) })
+	t.Run("Isolation", func(t *testing.T) { testIsolation(t, factory) })
+	t.Run("ReadOnly", func(t *testing.T) { testReadOnly(t, factory) })
+}
+
+// open returns a new database from factory, arranging for it to be
+// closed when the test is done.
+func open(t *testing.T, factory Factory) db.Db {
+	t.Helper()
+	d, err := factory()
+	Tassert(t, err == nil, "factory failed: %v", err)
+	t.Cleanup(func() {
+		err := d.Close()
+		Tassert(t, err == nil, "Close() failed: %v", err)
+	})
+	return d
+}
+
+// parse parses a time in the format used by db.Tadd.
+func parse(t *testing.T, str string) time.Time {
+	t.Helper()
+	tm, err := time.Parse("2006-01-02T15:04:05", str)
+	Tassert(t, err == nil, "time.Parse() failed: %v", err)
+	return tm
+}
+
+func testAddFind(t *testing.T, factory Factory) {
+	d := open(t, factory)
+	tx := d.NewTx(true)
+	defer tx.Abort()
+
+	i0900_1000 := db.Tadd(tx, 10, "2024-01-01T09:00:00", "2024-01-01T10:00:00", 2.0)
+	i1000_1100 := db.Tadd(tx, 20, "2024-01-01T10:00:00", "2024-01-01T11:00:00", 3.0)
+
+	ivs, err := tx.FindFwd(parse(t, "2024-01-01T09:00:00"), parse(t, "2024-01-01T11:00:00"), 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	Tassert(t, len(ivs) == 2, "FindFwd() failed: expected 2 intervals, got %v", spew.Sdump(ivs))
+	Tassert(t, ivs[0].Id == i0900_1000.Id && i0900_1000.Equal(ivs[0]), "expected interval %v, got %v", i0900_1000, ivs[0])
+	Tassert(t, ivs[0].Priority == i0900_1000.Priority, "expected priority %v, got %v", i0900_1000.Priority, ivs[0].Priority)
+	Tassert(t, ivs[1].Id == i1000_1100.Id && i1000_1100.Equal(ivs[1]), "expected interval %v, got %v", i1000_1100, ivs[1])
+	Tassert(t, ivs[1].Priority == i1000_1100.Priority, "expected priority %v, got %v", i1000_1100.Priority, ivs[1].Priority)
+}
+
+func testDelete(t *testing.T, factory Factory) {
+	d := open(t, factory)
+	tx := d.NewTx(true)
+	defer tx.Abort()
+
+	i0900_1000 := db.Tadd(tx, 10, "2024-01-01T09:00:00", "2024-01-01T10:00:00", 2.0)
+	i1000_1100 := db.Tadd(tx, 20, "2024-01-01T10:00:00", "2024-01-01T11:00:00", 3.0)
+
+	err := tx.Delete(i0900_1000)
+	Tassert(t, err == nil, "Delete() failed: %v", err)
+
+	ivs, err := tx.FindFwd(parse(t, "2024-01-01T09:00:00"), parse(t, "2024-01-01T11:00:00"), 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	Tassert(t, len(ivs) == 2, "FindFwd() failed: expected 2 intervals, got %v", spew.Sdump(ivs))
+	Tassert(t, ivs[0].Id == 0 && ivs[0].Equal(i0900_1000), "expected free interval in place of %v, got %v", i0900_1000, ivs[0])
+	Tassert(t, ivs[1].Id == i1000_1100.Id, "expected interval %v, got %v", i1000_1100, ivs[1])
+
+	// deleting an interval that does not exist is an error
+	err = tx.Delete(i0900_1000)
+	Tassert(t, errors.Is(err, db.ErrNotFound), "expected db.ErrNotFound, got %v", err)
+}
+
+func testGet(t *testing.T, factory Factory) {
+	d := open(t, factory)
+	tx := d.NewTx(true)
+	defer tx.Abort()
+	busy := addSchedule(tx)
+
+	iv, err := tx.Get(busy[1].Id)
+	Tassert(t, err == nil, "Get() failed: %v", err)
+	Tassert(t, iv.Id == busy[1].Id && busy[1].Equal(iv) && iv.Priority == busy[1].Priority, "expected interval %v, got %v", busy[1], iv)
+
+	// changing the result does not change the database
+	iv.Priority = 99.0
+	iv, err = tx.Get(busy[1].Id)
+	Tassert(t, err == nil, "Get() failed: %v", err)
+	Tassert(t, iv.Priority == busy[1].Priority, "expected priority %v, got %v", busy[1].Priority, iv.Priority)
+
+	_, err = tx.Get(99)
+	Tassert(t, errors.Is(err, db.ErrNotFound), "expected db.ErrNotFound, got %v", err)
+}
+
+func testDeleteById(t *testing.T, factory Factory) {
+	d := open(t, factory)
+	tx := d.NewTx(true)
+	defer tx.Abort()
+	busy := addSchedule(tx)
+
+	err := tx.DeleteById(busy[1].Id)
+	Tassert(t, err == nil, "DeleteById() failed: %v", err)
+	_, err = tx.Get(busy[1].Id)
+	Tassert(t, errors.Is(err, db.ErrNotFound), "expected db.ErrNotFound, got %v", err)
+	ivs, err := tx.FindFwd(busy[1].Start, busy[1].End, 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	Tassert(t, len(ivs) == 1 && ivs[0].Id == 0, "expected only free time, got %v", spew.Sdump(ivs))
+
+	err = tx.DeleteById(busy[1].Id)
+	Tassert(t, errors.Is(err, db.ErrNotFound), "expected db.ErrNotFound, got %v", err)
+}
+
+func testConflict(t *testing.T, factory Factory) {
+	d := open(t, factory)
+	tx := d.NewTx(true)
+	defer tx.Abort()
+
+	i0900_1000 := db.Tadd(tx, 10, "2024-01-01T09:00:00", "2024-01-01T10:00:00", 2.0)
+	i1000_1100 := db.Tadd(tx, 20, "2024-01-01T10:00:00", "2024-01-01T11:00:00", 3.0)
+
+	// an interval that overlaps both existing intervals is rejected
+	iv := interval.NewInterval(30, parse(t, "2024-01-01T09:30:00"), parse(t, "2024-01-01T10:30:00"), 1.0)
+	err := tx.Add(iv)
+	var cerr *db.ConflictError
+	Tassert(t, errors.As(err, &cerr), "expected *db.ConflictError, got %v", err)
+	Tassert(t, len(cerr.Conflicts) == 2, "expected 2 conflicts, got %v", spew.Sdump(cerr.Conflicts))
+	Tassert(t, cerr.Conflicts[0].Id == i0900_1000.Id, "expected conflict %v, got %v", i0900_1000, cerr.Conflicts[0])
+	Tassert(t, cerr.Conflicts[1].Id == i1000_1100.Id, "expected conflict %v, got %v", i1000_1100, cerr.Conflicts[1])
+
+	conflicts, err := db.Conflicts(tx, iv)
+	Tassert(t, err == nil, "Conflicts() failed: %v", err)
+	Tassert(t, conflicts, "Conflicts() should have returned true")
+
+	// the rejected interval was not stored
+	ivs, err := tx.FindFwd(parse(t, "2024-01-01T09:00:00"), parse(t, "2024-01-01T11:00:00"), 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	Tassert(t, len(ivs) == 2, "FindFwd() failed: expected 2 intervals, got %v", spew.Sdump(ivs))
+
+	// adjacent intervals do not conflict
+	db.Tadd(tx, 40, "2024-01-01T11:00:00", "2024-01-01T12:00:00", 1.0)
+
+	// adding an id that already exists is an error, on the same
+	// resource or another one, and leaves the stored interval alone
+	dup := interval.NewInterval(i0900_1000.Id, parse(t, "2024-01-01T09:00:00"), parse(t, "2024-01-01T10:00:00"), 2.0)
+	err = tx.Add(dup)
+	Tassert(t, errors.Is(err, db.ErrExists), "expected db.ErrExists, got %v", err)
+	dup.Resource = "bob"
+	err = tx.Add(dup)
+	Tassert(t, errors.Is(err, db.ErrExists), "expected db.ErrExists, got %v", err)
+	got, err := tx.Get(i0900_1000.Id)
+	Tassert(t, err == nil, "Get() failed: %v", err)
+	Tassert(t, got.Resource == "" && i0900_1000.Equal(got), "expected interval %v to be unchanged, got %v", i0900_1000, got)
+	ivs, err = db.Scope(tx, "bob").FindFwd(parse(t, "2024-01-01T09:00:00"), parse(t, "2024-01-01T10:00:00"), 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	Tassert(t, len(ivs) == 1 && ivs[0].Id == 0, "expected bob to be free, got %v", spew.Sdump(ivs))
+}
+
+func testUpdate(t *testing.T, factory Factory) {
+	d := open(t, factory)
+	tx := d.NewTx(true)
+	defer tx.Abort()
+	busy := addSchedule(tx)
+
+	// update interval 20 to run from 10:00 to 10:45 -- this
+	// overlaps its own old time but nothing else
+	iv := interval.NewInterval(busy[1].Id, parse(t, "2024-01-01T10:00:00"), parse(t, "2024-01-01T10:45:00"), 3.0)
+	iv.Payload = "updated"
+	err := tx.Update(iv)
+	Tassert(t, err == nil, "Update() failed: %v", err)
+	ivs, err := tx.FindFwd(parse(t, "2024-01-01T10:00:00"), parse(t, "2024-01-01T11:00:00"), 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	Tassert(t, len(ivs) == 2, "FindFwd() failed: expected 2 intervals, got %v", spew.Sdump(ivs))
+	Tassert(t, ivs[0].Id == iv.Id && iv.Equal(ivs[0]), "expected interval %v, got %v", iv, ivs[0])
+	Tassert(t, ivs[0].Payload == "updated", "expected payload %q, got %v", "updated", ivs[0].Payload)
+	Tassert(t, ivs[1].Id == 0 && ivs[1].Start.Equal(iv.End), "expected free interval, got %v", ivs[1])
+
+	// an update that conflicts with another interval is rejected
+	bad := interval.NewInterval(busy[1].Id, parse(t, "2024-01-01T09:30:00"), parse(t, "2024-01-01T10:45:00"), 3.0)
+	err = tx.Update(bad)
+	var cerr *db.ConflictError
+	Tassert(t, errors.As(err, &cerr), "expected *db.ConflictError, got %v", err)
+	Tassert(t, len(cerr.Conflicts) == 1 && cerr.Conflicts[0].Id == busy[0].Id, "expected conflict with %v, got %v", busy[0], spew.Sdump(cerr.Conflicts))
+	ivs, err = tx.FindFwd(parse(t, "2024-01-01T10:00:00"), parse(t, "2024-01-01T10:45:00"), 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	Tassert(t, len(ivs) == 1 && iv.Equal(ivs[0]), "expected interval %v to be unchanged, got %v", iv, spew.Sdump(ivs))
+
+	// updating to an empty or inverted interval is an error
+	for _, times := range [][]string{
+		{"2024-01-01T10:30:00", "2024-01-01T10:30:00"},
+		{"2024-01-01T10:45:00", "2024-01-01T10:30:00"},
+	} {
+		// NewInterval won't create these, so adjust a copy
+		bad := iv.Clone()
+		bad.Start = parse(t, times[0])
+		bad.End = parse(t, times[1])
+		err = tx.Update(bad)
+		Tassert(t, err != nil, "Update() to %v should have failed", bad)
+	}
+	got, err := tx.Get(busy[1].Id)
+	Tassert(t, err == nil, "Get() failed: %v", err)
+	Tassert(t, iv.Equal(got), "expected interval %v to be unchanged, got %v", iv, got)
+
+	// updating an interval that does not exist is an error
+	missing := interval.NewInterval(99, parse(t, "2024-01-01T15:00:00"), parse(t, "2024-01-01T16:00:00"), 1.0)
+	err = tx.Update(missing)
+	Tassert(t, errors.Is(err, db.ErrNotFound), "expected db.ErrNotFound, got %v", err)
+}
+
+func testMove(t *testing.T, factory Factory) {
+	d := open(t, factory)
+	tx := d.NewTx(true)
+	defer tx.Abort()
+	busy := addSchedule(tx)
+
+	// move interval 40 into the gap at 12:00
+	err := tx.Move(busy[3].Id, parse(t, "2024-01-01T12:00:00"), parse(t, "2024-01-01T13:00:00"))
+	Tassert(t, err == nil, "Move() failed: %v", err)
+	ivs, err := tx.FindFwd(parse(t, "2024-01-01T12:00:00"), parse(t, "2024-01-01T14:00:00"), 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	Tassert(t, len(ivs) == 2, "FindFwd() failed: expected 2 intervals, got %v", spew.Sdump(ivs))
+	Tassert(t, ivs[0].Id == busy[3].Id && ivs[0].Priority == busy[3].Priority, "expected interval %v, got %v", busy[3], ivs[0])
+	Tassert(t, ivs[0].Start.Equal(parse(t, "2024-01-01T12:00:00")), "expected interval to be moved, got %v", ivs[0])
+	Tassert(t, ivs[1].Id == 0 && ivs[1].Start.Equal(parse(t, "2024-01-01T13:00:00")), "expected free interval where it was, got %v", ivs[1])
+
+	// moving onto another interval is rejected
+	err = tx.Move(busy[3].Id, parse(t, "2024-01-01T11:30:00"), parse(t, "2024-01-01T12:30:00"))
+	var cerr *db.ConflictError
+	Tassert(t, errors.As(err, &cerr), "expected *db.ConflictError, got %v", err)
+
+	// moving to an empty interval is an error
+	err = tx.Move(busy[3].Id, parse(t, "2024-01-01T12:30:00"), parse(t, "2024-01-01T12:30:00"))
+	Tassert(t, err != nil, "Move() to an empty interval should have failed")
+
+	// moving an interval that does not exist is an error
+	err = tx.Move(99, parse(t, "2024-01-01T15:00:00"), parse(t, "2024-01-01T16:00:00"))
+	Tassert(t, errors.Is(err, db.ErrNotFound), "expected db.ErrNotFound, got %v", err)
+}
+
+func testSetPriority(t *testing.T, factory Factory) {
+	d := open(t, factory)
+	tx := d.NewTx(true)
+	defer tx.Abort()
+	busy := addSchedule(tx)
+
+	// raise interval 30 above the max priority of the query
+	err := tx.SetPriority(busy[2].Id, 5.0)
+	Tassert(t, err == nil, "SetPriority() failed: %v", err)
+	ivs, err := tx.FindFwd(busy[2].Start, busy[2].End, 4.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	Tassert(t, len(ivs) == 0, "FindFwd() failed: expected no intervals, got %v", spew.Sdump(ivs))
+	ivs, err = tx.FindFwd(busy[2].Start, busy[2].End, 5.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	Tassert(t, len(ivs) == 1 && ivs[0].Id == busy[2].Id && ivs[0].Priority == 5.0, "expected interval %v at priority 5, got %v", busy[2], spew.Sdump(ivs))
+
+	// setting the priority of an interval that does not exist is an error
+	err = tx.SetPriority(99, 1.0)
+	Tassert(t, errors.Is(err, db.ErrNotFound), "expected db.ErrNotFound, got %v", err)
+}
+
+// addSchedule adds a schedule with gaps to tx, returning the busy
+// intervals in ascending time order.  The gaps are 10:00-10:30 and
+// 12:00-13:00.
+func addSchedule(tx db.Tx) []*interval.Interval {
+	return []*interval.Interval{
+		db.Tadd(tx, 10, "2024-01-01T09:00:00", "2024-01-01T10:00:00", 2.0),
+		db.Tadd(tx, 20, "2024-01-01T10:30:00", "2024-01-01T11:00:00", 3.0),
+		db.Tadd(tx, 30, "2024-01-01T11:00:00", "2024-01-01T12:00:00", 1.0),
+		db.Tadd(tx, 40, "2024-01-01T13:00:00", "2024-01-01T14:00:00", 2.0),
+	}
+}
+
+func testIterate(t *testing.T, factory Factory) {
+	d := open(t, factory)
+	tx := d.NewTx(true)
+	defer tx.Abort()
+	addSchedule(tx)
+
+	collect := func(name string, iter db.Iterator, err error) (ids []uint64) {
+		Tassert(t, err == nil, "%s() failed: %v", name, err)
+		for iv := iter.Next(); iv != nil; iv = iter.Next() {
+			ids = append(ids, iv.Id)
+		}
+		return
+	}
+	check := func(name string, got []uint64, expect ...uint64) {
+		Tassert(t, len(got) == len(expect), "%s(): expected ids %v, got %v", name, expect, got)
+		for i := range expect {
+			Tassert(t, got[i] == expect[i], "%s(): expected ids %v, got %v", name, expect, got)
+		}
+	}
+
+	iter, err := tx.IterateForward()
+	check("IterateForward", collect("IterateForward", iter, err), 10, 20, 30, 40)
+	iter, err = tx.IterateBackward()
+	check("IterateBackward", collect("IterateBackward", iter, err), 40, 30, 20, 10)
+
+	// intervals 10 and 40 have the same priority, so only check the
+	// ends of the priority order and that it is monotonic
+	iter, err = tx.IterateUp()
+	up := collect("IterateUp", iter, err)
+	Tassert(t, len(up) == 4 && up[0] == 30 && up[3] == 20, "IterateUp(): expected 30 first and 20 last, got %v", up)
+	iter, err = tx.IterateDown()
+	Tassert(t, err == nil, "IterateDown() failed: %v", err)
+	var prev *interval.Interval
+	n := 0
+	for iv := iter.Next(); iv != nil; iv = iter.Next() {
+		Tassert(t, prev == nil || iv.Priority <= prev.Priority, "IterateDown(): %v after %v", iv, prev)
+		prev = iv
+		n++
+	}
+	Tassert(t, n == 4, "IterateDown(): expected 4 intervals, got %d", n)
+}
+
+func testFindOrder(t *testing.T, factory Factory) {
+	d := open(t, factory)
+	tx := d.NewTx(true)
+	defer tx.Abort()
+	busy := addSchedule(tx)
+
+	start := parse(t, "2024-01-01T09:00:00")
+	end := parse(t, "2024-01-01T14:00:00")
+
+	// forward results are in ascending time order
+	ivs, err := tx.FindFwd(start, end, 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	Tassert(t, len(ivs) == 6, "FindFwd() failed: expected 6 intervals, got %v", spew.Sdump(ivs))
+	for i := 1; i < len(ivs); i++ {
+		Tassert(t, !ivs[i].End.Before(ivs[i-1].End), "FindFwd() out of order: %v", spew.Sdump(ivs))
+	}
+	Tassert(t, ivs[0].Id == busy[0].Id, "expected interval %v, got %v", busy[0], ivs[0])
+	Tassert(t, ivs[5].Id == busy[3].Id, "expected interval %v, got %v", busy[3], ivs[5])
+
+	// reverse results are in descending time order
+	ivs, err = tx.FindRev(start, end, 99.0)
+	Tassert(t, err == nil, "FindRev() failed: %v", err)
+	Tassert(t, len(ivs) == 6, "FindRev() failed: expected 6 intervals, got %v", spew.Sdump(ivs))
+	for i := 1; i < len(ivs); i++ {
+		Tassert(t, !ivs[i].Start.After(ivs[i-1].Start), "FindRev() out of order: %v", spew.Sdump(ivs))
+	}
+	Tassert(t, ivs[0].Id == busy[3].Id, "expected interval %v, got %v", busy[3], ivs[0])
+	Tassert(t, ivs[5].Id == busy[0].Id, "expected interval %v, got %v", busy[0], ivs[5])
+
+	// only intervals that intersect the range are returned
+	ivs, err = tx.FindFwd(parse(t, "2024-01-01T10:45:00"), parse(t, "2024-01-01T11:30:00"), 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	Tassert(t, len(ivs) == 2, "FindFwd() failed: expected 2 intervals, got %v", spew.Sdump(ivs))
+	Tassert(t, ivs[0].Id == busy[1].Id, "expected interval %v, got %v", busy[1], ivs[0])
+	Tassert(t, ivs[1].Id == busy[2].Id, "expected interval %v, got %v", busy[2], ivs[1])
+}
+
+func testFindPriority(t *testing.T, factory Factory) {
+	d := open(t, factory)
+	tx := d.NewTx(true)
+	defer tx.Abort()
+	busy := addSchedule(tx)
+
+	start := parse(t, "2024-01-01T09:00:00")
+	end := parse(t, "2024-01-01T14:00:00")
+
+	// intervals above the max priority are left out, but they are
+	// not reported as free time either
+	ivs, err := tx.FindFwd(start, end, 2.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	var ids []uint64
+	for _, iv := range ivs {
+		Tassert(t, iv.Priority <= 2.0, "FindFwd() returned %v above max priority", iv)
+		Tassert(t, iv.Busy() || !iv.Overlaps(busy[1]), "FindFwd() returned free time %v over %v", iv, busy[1])
+		if iv.Busy() {
+			ids = append(ids, iv.Id)
+		}
+	}
+	Tassert(t, len(ids) == 3, "FindFwd() failed: expected 3 busy intervals, got %v", spew.Sdump(ivs))
+	Tassert(t, ids[0] == busy[0].Id && ids[1] == busy[2].Id && ids[2] == busy[3].Id, "FindFwd() returned wrong intervals: %v", spew.Sdump(ivs))
+}
+
+func testFreeIntervals(t *testing.T, factory Factory) {
+	d := open(t, factory)
+	tx := d.NewTx(true)
+	defer tx.Abort()
+	addSchedule(tx)
+
+	start := parse(t, "2024-01-01T09:00:00")
+	end := parse(t, "2024-01-01T14:00:00")
+	expect := []*interval.Interval{
+		interval.NewInterval(0, parse(t, "2024-01-01T10:00:00"), parse(t, "2024-01-01T10:30:00"), 0),
+		interval.NewInterval(0, parse(t, "2024-01-01T12:00:00"), parse(t, "2024-01-01T13:00:00"), 0),
+	}
+
+	checkFree := func(name string, ivs []*interval.Interval, expect []*interval.Interval) {
+		var free []*interval.Interval
+		for _, iv := range ivs {
+			if iv.Busy() {
+				continue
+			}
+			Tassert(t, iv.Id == 0, "%s: expected free interval id 0, got %v", name, iv)
+			free = append(free, iv)
+		}
+		Tassert(t, len(free) == len(expect), "%s: expected %d free intervals, got %v", name, len(expect), spew.Sdump(ivs))
+		for i := range expect {
+			Tassert(t, free[i].Start.Equal(expect[i].Start) && free[i].End.Equal(expect[i].End), "%s: expected free interval %v, got %v", name, expect[i], free[i])
+		}
+	}
+
+	ivs, err := tx.FindFwd(start, end, 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	checkFree("FindFwd", ivs, expect)
+
+	ivs, err = tx.FindRev(start, end, 99.0)
+	Tassert(t, err == nil, "FindRev() failed: %v", err)
+	checkFree("FindRev", ivs, []*interval.Interval{expect[1], expect[0]})
+}
+
+func testEdgeFreeIntervals(t *testing.T, factory Factory) {
+	d := open(t, factory)
+	tx := d.NewTx(true)
+	defer tx.Abort()
+
+	start := parse(t, "2024-01-01T08:00:00")
+	end := parse(t, "2024-01-01T15:00:00")
+
+	check := func(name string, ivs []*interval.Interval, expect ...string) {
+		Tassert(t, len(ivs) == len(expect)/3, "%s: expected %d intervals, got %v", name, len(expect)/3, spew.Sdump(ivs))
+		for i, iv := range ivs {
+			Tassert(t, Spf("%d", iv.Id) == expect[i*3], "%s: expected id %s, got %v", name, expect[i*3], iv)
+			Tassert(t, iv.Start.Equal(parse(t, expect[i*3+1])) && iv.End.Equal(parse(t, expect[i*3+2])), "%s: expected %s - %s, got %v", name, expect[i*3+1], expect[i*3+2], iv)
+		}
+	}
+
+	// an empty range is all free
+	ivs, err := tx.FindFwd(start, end, 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	check("empty FindFwd", ivs, "0", "2024-01-01T08:00:00", "2024-01-01T15:00:00")
+	ivs, err = tx.FindRev(start, end, 99.0)
+	Tassert(t, err == nil, "FindRev() failed: %v", err)
+	check("empty FindRev", ivs, "0", "2024-01-01T08:00:00", "2024-01-01T15:00:00")
+
+	// FindSet works on an empty calendar
+	set, err := db.FindSet(tx, true, start, end, time.Hour, 0)
+	Tassert(t, err == nil, "FindSet() failed: %v", err)
+	Tassert(t, len(set) == 1 && set[0].Id == 0, "expected one free interval, got %v", spew.Sdump(set))
+
+	// free time before the first and after the last interval
+	addSchedule(tx)
+	ivs, err = tx.FindFwd(start, end, 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	check("FindFwd", ivs,
+		"0", "2024-01-01T08:00:00", "2024-01-01T09:00:00",
+		"10", "2024-01-01T09:00:00", "2024-01-01T10:00:00",
+		"0", "2024-01-01T10:00:00", "2024-01-01T10:30:00",
+		"20", "2024-01-01T10:30:00", "2024-01-01T11:00:00",
+		"30", "2024-01-01T11:00:00", "2024-01-01T12:00:00",
+		"0", "2024-01-01T12:00:00", "2024-01-01T13:00:00",
+		"40", "2024-01-01T13:00:00", "2024-01-01T14:00:00",
+		"0", "2024-01-01T14:00:00", "2024-01-01T15:00:00")
+	ivs, err = tx.FindRev(start, end, 99.0)
+	Tassert(t, err == nil, "FindRev() failed: %v", err)
+	check("FindRev", ivs,
+		"0", "2024-01-01T14:00:00", "2024-01-01T15:00:00",
+		"40", "2024-01-01T13:00:00", "2024-01-01T14:00:00",
+		"0", "2024-01-01T12:00:00", "2024-01-01T13:00:00",
+		"30", "2024-01-01T11:00:00", "2024-01-01T12:00:00",
+		"20", "2024-01-01T10:30:00", "2024-01-01T11:00:00",
+		"0", "2024-01-01T10:00:00", "2024-01-01T10:30:00",
+		"10", "2024-01-01T09:00:00", "2024-01-01T10:00:00",
+		"0", "2024-01-01T08:00:00", "2024-01-01T09:00:00")
+
+	// a range that starts and ends inside gaps
+	ivs, err = tx.FindFwd(parse(t, "2024-01-01T12:15:00"), parse(t, "2024-01-01T14:30:00"), 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	check("FindFwd partial", ivs,
+		"0", "2024-01-01T12:15:00", "2024-01-01T13:00:00",
+		"40", "2024-01-01T13:00:00", "2024-01-01T14:00:00",
+		"0", "2024-01-01T14:00:00", "2024-01-01T14:30:00")
+	ivs, err = tx.FindRev(parse(t, "2024-01-01T12:15:00"), parse(t, "2024-01-01T14:30:00"), 99.0)
+	Tassert(t, err == nil, "FindRev() failed: %v", err)
+	check("FindRev partial", ivs,
+		"0", "2024-01-01T14:00:00", "2024-01-01T14:30:00",
+		"40", "2024-01-01T13:00:00", "2024-01-01T14:00:00",
+		"0", "2024-01-01T12:15:00", "2024-01-01T13:00:00")
+
+	// a range inside a gap is all free
+	ivs, err = tx.FindFwd(parse(t, "2024-01-01T12:15:00"), parse(t, "2024-01-01T12:45:00"), 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	check("FindFwd gap", ivs, "0", "2024-01-01T12:15:00", "2024-01-01T12:45:00")
+}
+
+func testFindSet(t *testing.T, factory Factory) {
+	d := open(t, factory)
+	tx := d.NewTx(true)
+	defer tx.Abort()
+	busy := addSchedule(tx)
+
+	start := parse(t, "2024-01-01T09:00:00")
+	end := parse(t, "2024-01-01T14:00:00")
+
+	// at or below priority 1, the first 90 minute set is interval
+	// 30 followed by the free time from 12:00 to 13:00
+	set, err := db.FindSet(tx, true, start, end, 90*time.Minute, 1.0)
+	Tassert(t, err == nil, "FindSet() failed: %v", err)
+	Tassert(t, len(set) == 2, "FindSet() failed: expected 2 intervals, got %v", spew.Sdump(set))
+	Tassert(t, set[0].Id == busy[2].Id, "expected interval %v, got %v", busy[2], set[0])
+	Tassert(t, set[1].Id == 0 && set[1].Start.Equal(busy[2].End), "expected free interval, got %v", set[1])
+
+	// at or below priority 2, the last 90 minute set is interval 40
+	// preceded by the free time from 12:00 to 13:00
+	set, err = db.FindSet(tx, false, start, end, 90*time.Minute, 2.0)
+	Tassert(t, err == nil, "FindSet() failed: %v", err)
+	Tassert(t, len(set) == 2, "FindSet() failed: expected 2 intervals, got %v", spew.Sdump(set))
+	Tassert(t, set[0].Id == busy[3].Id, "expected interval %v, got %v", busy[3], set[0])
+	Tassert(t, set[1].Id == 0 && set[1].End.Equal(busy[3].Start), "expected free interval, got %v", set[1])
+
+	// nothing is long enough
+	set, err = db.FindSet(tx, true, start, end, 3*time.Hour, 1.0)
+	Tassert(t, err == nil, "FindSet() failed: %v", err)
+	Tassert(t, set == nil, "FindSet() should have returned nil, got %v", spew.Sdump(set))
+}
+
+func testFindFree(t *testing.T, factory Factory) {
+	d := open(t, factory)
+	tx := d.NewTx(true)
+	defer tx.Abort()
+	addSchedule(tx)
+	// a stored free interval next to synthetic free time is merged
+	// with it
+	db.Tadd(tx, 50, "2024-01-01T12:00:00", "2024-01-01T12:30:00", 0)
+
+	start := parse(t, "2024-01-01T09:00:00")
+	end := parse(t, "2024-01-01T14:00:00")
+
+	check := func(name string, free []*interval.Interval, expect ...string) {
+		Tassert(t, len(free) == len(expect)/2, "%s: expected %d free intervals, got %v", name, len(expect)/2, spew.Sdump(free))
+		for i, iv := range free {
+			Tassert(t, iv.Id == 0 && iv.Priority == 0, "%s: expected a free interval, got %v", name, iv)
+			Tassert(t, iv.Start.Equal(parse(t, expect[i*2])) && iv.End.Equal(parse(t, expect[i*2+1])), "%s: expected free interval %s - %s, got %v", name, expect[i*2], expect[i*2+1], iv)
+		}
+	}
+
+	free, err := db.FindFree(tx, start, end, 0)
+	Tassert(t, err == nil, "FindFree() failed: %v", err)
+	check("FindFree", free,
+		"2024-01-01T10:00:00", "2024-01-01T10:30:00",
+		"2024-01-01T12:00:00", "2024-01-01T13:00:00")
+
+	// the half hour gap is too short
+	free, err = db.FindFree(tx, start, end, time.Hour)
+	Tassert(t, err == nil, "FindFree() failed: %v", err)
+	check("FindFree minGap", free,
+		"2024-01-01T12:00:00", "2024-01-01T13:00:00")
+
+	// results are clipped to the search range
+	free, err = db.FindFree(tx, start, parse(t, "2024-01-01T12:15:00"), 0)
+	Tassert(t, err == nil, "FindFree() failed: %v", err)
+	check("FindFree clipped", free,
+		"2024-01-01T10:00:00", "2024-01-01T10:30:00",
+		"2024-01-01T12:00:00", "2024-01-01T12:15:00")
+
+	// backward
+	iter, err := db.FindFreeIter(tx, false, start, end, 0)
+	Tassert(t, err == nil, "FindFreeIter() failed: %v", err)
+	free = nil
+	for iv := iter.Next(); iv != nil; iv = iter.Next() {
+		free = append(free, iv)
+	}
+	check("FindFreeIter rev", free,
+		"2024-01-01T12:00:00", "2024-01-01T13:00:00",
+		"2024-01-01T10:00:00", "2024-01-01T10:30:00")
+
+	// the part of a stored free interval under a busy one is not
+	// free
+	carol := db.Scope(tx, "carol")
+	db.Tadd(carol, 60, "2024-01-01T09:00:00", "2024-01-01T12:00:00", 0)
+	db.Tadd(carol, 70, "2024-01-01T10:00:00", "2024-01-01T11:00:00", 1.0)
+	free, err = db.FindFree(carol, start, parse(t, "2024-01-01T12:00:00"), 0)
+	Tassert(t, err == nil, "FindFree() failed: %v", err)
+	check("FindFree layered", free,
+		"2024-01-01T09:00:00", "2024-01-01T10:00:00",
+		"2024-01-01T11:00:00", "2024-01-01T12:00:00")
+}
+
+func testClip(t *testing.T, factory Factory) {
+	d := open(t, factory)
+	tx := d.NewTx(true)
+	defer tx.Abort()
+	busy := addSchedule(tx)
+
+	start := parse(t, "2024-01-01T09:30:00")
+	end := parse(t, "2024-01-01T13:30:00")
+
+	iter, err := tx.FindFwdIter(start, end, 99.0)
+	Tassert(t, err == nil, "FindFwdIter() failed: %v", err)
+	var ivs []*interval.Interval
+	clip := db.ClipIter(iter, start, end)
+	for iv := clip.Next(); iv != nil; iv = clip.Next() {
+		ivs = append(ivs, iv)
+	}
+	Tassert(t, len(ivs) == 6, "expected 6 intervals, got %v", spew.Sdump(ivs))
+	first := ivs[0]
+	Tassert(t, first.Id == busy[0].Id && first.Priority == busy[0].Priority, "expected interval %v, got %v", busy[0], first)
+	Tassert(t, first.Start.Equal(start) && first.End.Equal(busy[0].End), "expected interval clipped to start at %v, got %v", start, first)
+	last := ivs[len(ivs)-1]
+	Tassert(t, last.Id == busy[3].Id, "expected interval %v, got %v", busy[3], last)
+	Tassert(t, last.Start.Equal(busy[3].Start) && last.End.Equal(end), "expected interval clipped to end at %v, got %v", end, last)
+
+	// clipping does not change the stored intervals
+	iv, err := tx.Get(busy[0].Id)
+	Tassert(t, err == nil, "Get() failed: %v", err)
+	Tassert(t, iv.Start.Equal(busy[0].Start), "expected stored interval %v, got %v", busy[0], iv)
+
+	// FindSet only counts the half hour of interval 10 that is in
+	// the window, so it needs the free time after it as well
+	set, err := db.FindSet(tx, true, start, end, time.Hour, 2.0)
+	Tassert(t, err == nil, "FindSet() failed: %v", err)
+	Tassert(t, len(set) == 2, "FindSet() failed: expected 2 intervals, got %v", spew.Sdump(set))
+	Tassert(t, set[0].Id == busy[0].Id && set[1].Id == 0, "expected interval %v and free time, got %v", busy[0], spew.Sdump(set))
+}
+
+func testResources(t *testing.T, factory Factory) {
+	d := open(t, factory)
+	tx := d.NewTx(true)
+	defer tx.Abort()
+
+	// the same time slot on different resources does not conflict
+	addSchedule(tx)
+	alice := db.Scope(tx, "alice")
+	bob := db.Scope(tx, "bob")
+	a1 := db.Tadd(alice, 50, "2024-01-01T09:00:00", "2024-01-01T10:00:00", 2.0)
+	b1 := db.Tadd(bob, 60, "2024-01-01T09:00:00", "2024-01-01T10:00:00", 2.0)
+	b2 := db.Tadd(bob, 70, "2024-01-01T11:00:00", "2024-01-01T12:00:00", 1.0)
+
+	// the stored copy is on the scope's resource, but the caller's
+	// interval is not changed
+	iv, err := tx.Get(b1.Id)
+	Tassert(t, err == nil, "Get() failed: %v", err)
+	Tassert(t, iv.Resource == "bob", "expected resource bob, got %q", iv.Resource)
+	Tassert(t, a1.Resource == "" && b1.Resource == "", "expected caller's resources unchanged, got %q and %q", a1.Resource, b1.Resource)
+	iv.Resource = "carol"
+	err = bob.Update(iv)
+	Tassert(t, err == nil, "Update() failed: %v", err)
+	Tassert(t, iv.Resource == "carol", "expected caller's resource unchanged, got %q", iv.Resource)
+	iv, err = tx.Get(b1.Id)
+	Tassert(t, err == nil, "Get() failed: %v", err)
+	Tassert(t, iv.Resource == "bob", "expected resource bob, got %q", iv.Resource)
+
+	// the same time slot on the same resource does
+	iv = interval.NewInterval(80, parse(t, "2024-01-01T09:30:00"), parse(t, "2024-01-01T10:30:00"), 1.0)
+	conflicts, err := db.Conflicts(alice, iv)
+	Tassert(t, err == nil, "Conflicts() failed: %v", err)
+	Tassert(t, conflicts, "expected a conflict with %v", a1)
+	iv.Resource = "carol"
+	conflicts, err = db.Conflicts(tx, iv)
+	Tassert(t, err == nil, "Conflicts() failed: %v", err)
+	Tassert(t, !conflicts, "expected no conflict on an empty resource")
+	err = alice.Add(interval.NewInterval(80, parse(t, "2024-01-01T09:30:00"), parse(t, "2024-01-01T10:30:00"), 1.0))
+	var cerr *db.ConflictError
+	Tassert(t, errors.As(err, &cerr), "expected *db.ConflictError, got %v", err)
+	Tassert(t, len(cerr.Conflicts) == 1 && cerr.Conflicts[0].Id == a1.Id, "expected conflict with %v, got %v", a1, cerr.Conflicts)
+
+	start := parse(t, "2024-01-01T09:00:00")
+	end := parse(t, "2024-01-01T14:00:00")
+
+	// each resource has its own calendar
+	busyIds := func(iter db.Iterator) (ids []uint64) {
+		for iv := iter.Next(); iv != nil; iv = iter.Next() {
+			if iv.Busy() {
+				ids = append(ids, iv.Id)
+			}
+		}
+		return
+	}
+	iter, err := tx.FindFwdIter(start, end, 99.0)
+	Tassert(t, err == nil, "FindFwdIter() failed: %v", err)
+	ids := busyIds(iter)
+	Tassert(t, len(ids) == 4 && ids[0] == 10, "expected the default resource's intervals, got %v", ids)
+	iter, err = tx.FindFwdIterIn("bob", start, end, 99.0)
+	Tassert(t, err == nil, "FindFwdIterIn() failed: %v", err)
+	ids = busyIds(iter)
+	Tassert(t, len(ids) == 2 && ids[0] == b1.Id && ids[1] == b2.Id, "expected bob's intervals, got %v", ids)
+	iter, err = tx.FindRevIterIn("alice", start, end, 99.0)
+	Tassert(t, err == nil, "FindRevIterIn() failed: %v", err)
+	ids = busyIds(iter)
+	Tassert(t, len(ids) == 1 && ids[0] == a1.Id, "expected alice's intervals, got %v", ids)
+	iter, err = tx.FindFwdIterIn("carol", start, end, 99.0)
+	Tassert(t, err == nil, "FindFwdIterIn() failed: %v", err)
+	ivs := []*interval.Interval{}
+	for iv := iter.Next(); iv != nil; iv = iter.Next() {
+		ivs = append(ivs, iv)
+	}
+	Tassert(t, len(ivs) == 1 && !ivs[0].Busy(), "expected carol to be free, got %v", spew.Sdump(ivs))
+
+	// scoped FindSet -- bob is free from 10:00 to 11:00, and
+	// interval 70 can be displaced at priority 1
+	set, err := db.FindSet(bob, true, start, end, 3*time.Hour, 1.0)
+	Tassert(t, err == nil, "FindSet() failed: %v", err)
+	Tassert(t, len(set) == 3 && set[1].Id == b2.Id, "expected free time around interval %v, got %v", b2, spew.Sdump(set))
+
+	// scoped iteration only sees the resource's intervals
+	iter, err = bob.IterateForward()
+	Tassert(t, err == nil, "IterateForward() failed: %v", err)
+	ids = busyIds(iter)
+	Tassert(t, len(ids) == 2 && ids[0] == b1.Id, "expected bob's intervals, got %v", ids)
+	iter, err = tx.IterateForward()
+	Tassert(t, err == nil, "IterateForward() failed: %v", err)
+	ids = busyIds(iter)
+	Tassert(t, len(ids) == 7, "expected all intervals, got %v", ids)
+
+	// moving an interval keeps its resource
+	err = tx.Move(b1.Id, parse(t, "2024-01-01T10:00:00"), parse(t, "2024-01-01T11:00:00"))
+	Tassert(t, err == nil, "Move() failed: %v", err)
+	iter, err = tx.FindFwdIterIn("bob", start, end, 99.0)
+	Tassert(t, err == nil, "FindFwdIterIn() failed: %v", err)
+	ids = busyIds(iter)
+	Tassert(t, len(ids) == 2 && ids[0] == b1.Id, "expected bob's intervals, got %v", ids)
+}
+
+func testAtNextPrev(t *testing.T, factory Factory) {
+	d := open(t, factory)
+	tx := d.NewTx(true)
+	defer tx.Abort()
+	busy := addSchedule(tx)
+
+	checkAt := func(at string, expect ...*interval.Interval) {
+		ivs, err := tx.At(parse(t, at))
+		Tassert(t, err == nil, "At(%s) failed: %v", at, err)
+		Tassert(t, len(ivs) == len(expect), "At(%s): expected %v, got %v", at, expect, spew.Sdump(ivs))
+		for i := range expect {
+			Tassert(t, ivs[i].Id == expect[i].Id && ivs[i].Start.Equal(expect[i].Start) && ivs[i].End.Equal(expect[i].End), "At(%s): expected %v, got %v", at, expect[i], ivs[i])
+		}
+	}
+	free := func(start, end time.Time) *interval.Interval {
+		return &interval.Interval{Start: start, End: end}
+	}
+	checkAt("2024-01-01T09:30:00", busy[0])
+	// intervals contain their start time but not their end time
+	checkAt("2024-01-01T09:00:00", busy[0])
+	checkAt("2024-01-01T11:00:00", busy[2])
+	checkAt("2024-01-01T10:00:00", free(busy[0].End, busy[1].Start))
+	checkAt("2024-01-01T12:30:00", free(busy[2].End, busy[3].Start))
+	// before the first and after the last interval
+	checkAt("2024-01-01T08:00:00", free(util.EarliestTime, busy[0].Start))
+	checkAt("2024-01-01T15:00:00", free(busy[3].End, util.LatestTime))
+
+	checkNext := func(at string, expect *interval.Interval) {
+		iv, err := tx.Next(parse(t, at))
+		Tassert(t, err == nil, "Next(%s) failed: %v", at, err)
+		if expect == nil {
+			Tassert(t, iv == nil, "Next(%s): expected nil, got %v", at, iv)
+			return
+		}
+		Tassert(t, iv != nil && iv.Id == expect.Id, "Next(%s): expected %v, got %v", at, expect, iv)
+	}
+	checkNext("2024-01-01T08:00:00", busy[0])
+	checkNext("2024-01-01T09:30:00", busy[1])
+	checkNext("2024-01-01T10:30:00", busy[2])
+	checkNext("2024-01-01T13:00:00", nil)
+
+	checkPrev := func(at string, expect *interval.Interval) {
+		iv, err := tx.Prev(parse(t, at))
+		Tassert(t, err == nil, "Prev(%s) failed: %v", at, err)
+		if expect == nil {
+			Tassert(t, iv == nil, "Prev(%s): expected nil, got %v", at, iv)
+			return
+		}
+		Tassert(t, iv != nil && iv.Id == expect.Id, "Prev(%s): expected %v, got %v", at, expect, iv)
+	}
+	checkPrev("2024-01-01T15:00:00", busy[3])
+	checkPrev("2024-01-01T10:45:00", busy[0])
+	checkPrev("2024-01-01T11:00:00", busy[1])
+	checkPrev("2024-01-01T09:00:00", nil)
+
+	// scoped transactions look at their own resource
+	bob := db.Scope(tx, "bob")
+	b1 := db.Tadd(bob, 60, "2024-01-01T12:00:00", "2024-01-01T13:00:00", 1.0)
+	ivs, err := bob.At(parse(t, "2024-01-01T12:30:00"))
+	Tassert(t, err == nil, "At() failed: %v", err)
+	Tassert(t, len(ivs) == 1 && ivs[0].Id == b1.Id, "expected %v, got %v", b1, spew.Sdump(ivs))
+	ivs, err = bob.At(parse(t, "2024-01-01T09:30:00"))
+	Tassert(t, err == nil, "At() failed: %v", err)
+	Tassert(t, len(ivs) == 1 && ivs[0].Id == 0 && ivs[0].End.Equal(b1.Start) && ivs[0].Resource == "bob", "expected free time on bob, got %v", spew.Sdump(ivs))
+	iv, err := bob.Next(parse(t, "2024-01-01T09:00:00"))
+	Tassert(t, err == nil, "Next() failed: %v", err)
+	Tassert(t, iv != nil && iv.Id == b1.Id, "expected %v, got %v", b1, iv)
+	iv, err = bob.Prev(parse(t, "2024-01-01T12:00:00"))
+	Tassert(t, err == nil, "Prev() failed: %v", err)
+	Tassert(t, iv == nil, "expected nil, got %v", iv)
+
+	// stored free intervals can overlap busy ones
+	carol := db.Scope(tx, "carol")
+	c5 := db.Tadd(carol, 5, "2024-01-01T08:00:00", "2024-01-01T18:00:00", 0.0)
+	c6 := db.Tadd(carol, 6, "2024-01-01T09:00:00", "2024-01-01T10:00:00", 1.0)
+	checkIds := func(at string, expect ...uint64) {
+		ivs, err := carol.At(parse(t, at))
+		Tassert(t, err == nil, "At(%s) failed: %v", at, err)
+		got := make(map[uint64]bool)
+		for _, iv := range ivs {
+			got[iv.Id] = true
+		}
+		Tassert(t, len(ivs) == len(expect) && len(got) == len(expect), "At(%s): expected ids %v, got %v", at, expect, spew.Sdump(ivs))
+		for _, id := range expect {
+			Tassert(t, got[id], "At(%s): expected ids %v, got %v", at, expect, spew.Sdump(ivs))
+		}
+	}
+	checkIds("2024-01-01T12:00:00", c5.Id)
+	checkIds("2024-01-01T09:30:00", c5.Id, c6.Id)
+	checkIds("2024-01-01T08:30:00", c5.Id)
+	// the free interval is found even when it reaches back past
+	// several busy intervals
+	c7 := db.Tadd(carol, 7, "2024-01-01T11:00:00", "2024-01-01T12:00:00", 1.0)
+	checkIds("2024-01-01T11:30:00", c5.Id, c7.Id)
+	checkIds("2024-01-01T12:30:00", c5.Id)
+	// outside the stored free interval, the synthetic gap reaches to
+	// the nearest busy intervals
+	ivs, err = carol.At(parse(t, "2024-01-01T19:00:00"))
+	Tassert(t, err == nil, "At() failed: %v", err)
+	Tassert(t, len(ivs) == 1 && ivs[0].Id == 0 && ivs[0].Start.Equal(c7.End) && ivs[0].End.Equal(util.LatestTime), "expected free time after %v, got %v", c7, spew.Sdump(ivs))
+	ivs, err = carol.At(parse(t, "2024-01-01T07:00:00"))
+	Tassert(t, err == nil, "At() failed: %v", err)
+	Tassert(t, len(ivs) == 1 && ivs[0].Id == 0 && ivs[0].Start.Equal(util.EarliestTime) && ivs[0].End.Equal(c6.Start), "expected free time before %v, got %v", c6, spew.Sdump(ivs))
+}
+
+func testPool(t *testing.T, factory Factory) {
+	d := open(t, factory)
+	tx := d.NewTx(true)
+	defer tx.Abort()
+	lab := db.Pool{Name: "lab", Capacity: 2}
+
+	add := func(id uint64, start, end string) (*interval.Interval, error) {
+		iv := interval.NewInterval(id, parse(t, "2024-01-01T"+start), parse(t, "2024-01-01T"+end), 1.0)
+		return iv, db.AddToPool(tx, lab, iv)
+	}
+	z, err := add(1, "02:00:00", "06:00:00")
+	Tassert(t, err == nil && z.Resource == "lab/0", "AddToPool() failed: %v %v", err, z)
+	y, err := add(2, "03:00:00", "05:00:00")
+	Tassert(t, err == nil && y.Resource == "lab/1", "AddToPool() failed: %v %v", err, y)
+	err = tx.Delete(z)
+	Tassert(t, err == nil, "Delete() failed: %v", err)
+	x, err := add(3, "00:00:00", "02:00:00")
+	Tassert(t, err == nil && x.Resource == "lab/0", "AddToPool() failed: %v %v", err, x)
+
+	// w overlaps x on lab/0 and y on lab/1, but never more than one
+	// of them at a time, so y is moved to make room
+	w, err := add(4, "01:00:00", "04:00:00")
+	Tassert(t, err == nil, "AddToPool() failed: %v", err)
+	Tassert(t, w.Resource == "lab/1", "expected w on lab/1, got %v", w.Resource)
+	got, err := tx.Get(y.Id)
+	Tassert(t, err == nil, "Get() failed: %v", err)
+	Tassert(t, got.Resource == "lab/0", "expected y moved to lab/0, got %v", got.Resource)
+
+	// FreeCapacity and FindPoolSet agree with AddToPool
+	segments, err := db.FreeCapacity(tx, lab, parse(t, "2024-01-01T00:00:00"), parse(t, "2024-01-01T06:00:00"), 0)
+	Tassert(t, err == nil, "FreeCapacity() failed: %v", err)
+	expect := []int{1, 0, 1, 0, 1, 2}
+	Tassert(t, len(segments) == len(expect), "expected %d segments, got %v", len(expect), spew.Sdump(segments))
+	for i, seg := range segments {
+		Tassert(t, seg.Free == expect[i], "segment %d: expected free %d, got %v", i, expect[i], seg)
+	}
+	slot, err := db.FindPoolSet(tx, lab, 1, false, parse(t, "2024-01-01T00:00:00"), parse(t, "2024-01-01T04:00:00"), time.Hour, 0)
+	Tassert(t, err == nil, "FindPoolSet() failed: %v", err)
+	Tassert(t, slot != nil && slot.Start.Equal(parse(t, "2024-01-01T02:00:00")) && slot.Free == 1, "expected slot at 02:00, got %v", slot)
+	_, err = add(5, slot.Start.Format("15:04:05"), slot.End.Format("15:04:05"))
+	Tassert(t, err == nil, "AddToPool() failed: %v", err)
+
+	// the pool is now full from 01:00 to 04:00
+	u, err := add(6, "03:30:00", "03:45:00")
+	var cerr *db.ConflictError
+	Tassert(t, errors.As(err, &cerr), "expected ConflictError, got %v", err)
+	Tassert(t, len(cerr.Conflicts) == 2, "expected 2 conflicts, got %v", spew.Sdump(cerr.Conflicts))
+	Tassert(t, u.Resource == "", "expected resource unchanged, got %q", u.Resource)
+	slot, err = db.FindPoolSet(tx, lab, 1, true, parse(t, "2024-01-01T01:00:00"), parse(t, "2024-01-01T04:00:00"), time.Minute, 0)
+	Tassert(t, err == nil, "FindPoolSet() failed: %v", err)
+	Tassert(t, slot == nil, "expected no slot, got %v", slot)
+}
+
+func testCommit(t *testing.T, factory Factory) {
+	d := open(t, factory)
+	tx := d.NewTx(true)
+	iv := db.Tadd(tx, 10, "2024-01-01T09:00:00", "2024-01-01T10:00:00", 2.0)
+	err := tx.Commit()
+	Tassert(t, err == nil, "Commit() failed: %v", err)
+
+	// a new transaction sees the committed interval
+	tx = d.NewTx(false)
+	defer tx.Abort()
+	ivs, err := tx.FindFwd(iv.Start, iv.End, 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	Tassert(t, len(ivs) == 1 && ivs[0].Id == iv.Id, "expected interval %v, got %v", iv, spew.Sdump(ivs))
+}
+
+func testAbort(t *testing.T, factory Factory) {
+	d := open(t, factory)
+	tx := d.NewTx(true)
+	iv := db.Tadd(tx, 10, "2024-01-01T09:00:00", "2024-01-01T10:00:00", 2.0)
+	tx.Abort()
+
+	// a new transaction does not see the aborted interval
+	tx = d.NewTx(false)
+	defer tx.Abort()
+	ivs, err := tx.FindFwd(iv.Start, iv.End, 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	for _, found := range ivs {
+		Tassert(t, !found.Busy(), "found aborted interval %v", found)
+	}
+}
+
+func testIsolation(t *testing.T, factory Factory) {
+	d := open(t, factory)
+	wtx := d.NewTx(true)
+	iv := db.Tadd(wtx, 10, "2024-01-01T09:00:00", "2024-01-01T10:00:00", 2.0)
+
+	// the write transaction sees its own changes
+	ivs, err := wtx.FindFwd(iv.Start, iv.End, 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	Tassert(t, len(ivs) == 1 && ivs[0].Id == iv.Id, "expected interval %v, got %v", iv, spew.Sdump(ivs))
+
+	// a read transaction does not see uncommitted changes
+	rtx := d.NewTx(false)
+	ivs, err = rtx.FindFwd(iv.Start, iv.End, 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	for _, found := range ivs {
+		Tassert(t, !found.Busy(), "found uncommitted interval %v", found)
+	}
+	rtx.Abort()
+
+	err = wtx.Commit()
+	Tassert(t, err == nil, "Commit() failed: %v", err)
+
+	// a read transaction started after the commit sees the changes
+	rtx = d.NewTx(false)
+	defer rtx.Abort()
+	ivs, err = rtx.FindFwd(iv.Start, iv.End, 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	Tassert(t, len(ivs) == 1 && ivs[0].Id == iv.Id, "expected interval %v, got %v", iv, spew.Sdump(ivs))
+}
+
+func testReadOnly(t *testing.T, factory Factory) {
+	d := open(t, factory)
+	tx := d.NewTx(false)
+	defer tx.Abort()
+
+	iv := interval.NewInterval(10, parse(t, "2024-01-01T09:00:00"), parse(t, "2024-01-01T10:00:00"), 2.0)
+	err := tx.Add(iv)
+	Tassert(t, err != nil, "Add() in a read transaction should have failed")
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/stevegt/timectl/v3/interval"
+)
+
+// ErrNotFound is wrapped by the errors that Tx methods return when
+// there is no interval with the requested id.  Use errors.Is to check
+// for it.
+var ErrNotFound = errors.New("interval not found")
+
+// ErrExists is wrapped by the error that Tx.Add returns when there is
+// already an interval with the same id.  Use Update to replace it.
+var ErrExists = errors.New("interval already exists")
+
+// ConflictError is returned by Tx.Add when the interval being added
+// conflicts with one or more existing busy intervals.
+type ConflictError struct {
+	// Interval is the interval that could not be added.
+	Interval *interval.Interval
+	// Conflicts are the existing intervals that Interval conflicts
+	// with, in ascending order of end time.
+	Conflicts []*interval.Interval
+}
+
+// Error satisfies the error interface.
+func (e *ConflictError) Error() string {
+	var strs []string
+	for _, iv := range e.Conflicts {
+		strs = append(strs, iv.String())
+	}
+	return fmt.Sprintf("interval %v conflicts with %s", e.Interval, strings.Join(strs, ", "))
+}
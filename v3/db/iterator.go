@@ -0,0 +1,182 @@
+package db
+
+import (
+	"time"
+
+	"github.com/stevegt/timectl/v3/interval"
+	"github.com/stevegt/timectl/v3/util"
+)
+
+// FindIterator is an iterator for the Find* functions.  It filters
+// the intervals returned by a backend's bounds iterator and creates
+// the synthetic free intervals between them, including the free time
+// at either edge of the search range.
+type FindIterator struct {
+	boundsIter  Iterator
+	fwd         bool
+	minStart    time.Time
+	maxEnd      time.Time
+	maxPriority float64
+	// cursor is the time up to which we have accounted for the
+	// search range -- it moves from minStart toward maxEnd when
+	// iterating forward, and from maxEnd toward minStart when
+	// iterating backward
+	cursor time.Time
+	done   bool
+	queue  []*interval.Interval
+}
+
+// NewFindIterator creates a new FindIterator.  If fwd is true,
+// boundsIter must return intervals in ascending order of end time,
+// starting with the first interval that ends on or after minStart.  If
+// fwd is false, boundsIter must return intervals in descending order
+// of start time, starting with the last interval that starts on or
+// before maxEnd.
+func NewFindIterator(boundsIter Iterator, fwd bool, minStart, maxEnd time.Time, maxPriority float64) *FindIterator {
+	cursor := minStart
+	if !fwd {
+		cursor = maxEnd
+	}
+	return &FindIterator{
+		boundsIter:  boundsIter,
+		fwd:         fwd,
+		minStart:    minStart,
+		maxEnd:      maxEnd,
+		maxPriority: maxPriority,
+		cursor:      cursor,
+	}
+}
+
+// Next returns the next interval.
+func (iter *FindIterator) Next() *interval.Interval {
+	// How this works:  We keep a short queue of intervals we want to
+	// return.  If the queue is not empty, we return the first interval
+	// in the queue.  Otherwise, we fetch and filter intervals from
+	// the underlying bounds iterator, creating free intervals as
+	// needed, putting results on the queue.  The queue is the only
+	// place we return intervals from.
+
+	// retry until we have something to return
+	for {
+		// return any queued intervals -- this is the only place we
+		// return from, including free intervals and nil
+		if len(iter.queue) > 0 {
+			iv := iter.queue[0]
+			iter.queue = iter.queue[1:]
+			return iv
+		}
+		if iter.done {
+			return nil
+		}
+
+		// get the next interval from the bounds iterator
+		iv := iter.boundsIter.Next()
+		if iv == nil || (iter.fwd && iv.IsAfterTime(iter.maxEnd)) || (!iter.fwd && iv.IsBeforeTime(iter.minStart)) {
+			// we've run out of intervals, or the interval is past
+			// the end of the search range: whatever is left of the
+			// range between the cursor and the far edge is free
+			if iter.fwd {
+				iter.queueFree(iter.cursor, iter.maxEnd)
+			} else {
+				iter.queueFree(iter.minStart, iter.cursor)
+			}
+			iter.done = true
+			continue
+		}
+
+		// If the interval is not within the min start and max end
+		// times, skip it. This can happen on the first call to Next()
+		// because the LowerBound call returns the first interval
+		// that ends on or after the min start time, and the
+		// ReverseLowerBound call returns the first interval that
+		// starts on or after the max end time.
+		if iv.IsBeforeTime(iter.minStart) || iv.IsAfterTime(iter.maxEnd) {
+			continue
+		}
+
+		// create a free interval between the cursor and the current
+		// interval, then move the cursor past the current interval
+		if iter.fwd {
+			iter.queueFree(iter.cursor, util.MinTime(iv.Start, iter.maxEnd))
+			iter.cursor = util.MaxTime(iter.cursor, iv.End)
+		} else {
+			iter.queueFree(util.MaxTime(iv.End, iter.minStart), iter.cursor)
+			iter.cursor = util.MinTime(iter.cursor, iv.Start)
+		}
+
+		// if the interval has a higher priority than the max priority, skip it
+		if iv.Priority > iter.maxPriority {
+			continue
+		}
+
+		// we have a valid interval -- put it in the queue
+		iter.queue = append(iter.queue, iv)
+	}
+}
+
+// queueFree puts a synthetic free interval from start to end on the
+// queue.  It does nothing if the interval would not have a positive
+// duration, which happens when one interval ends at the same time as
+// the next one starts.
+func (iter *FindIterator) queueFree(start, end time.Time) {
+	if !end.After(start) {
+		return
+	}
+	iter.queue = append(iter.queue, &interval.Interval{
+		Start:    start,
+		End:      end,
+		Priority: 0,
+	})
+}
+
+// ClipIterator is an iterator that clips the intervals returned by
+// an underlying iterator to a time range.
+type ClipIterator struct {
+	iter     Iterator
+	minStart time.Time
+	maxEnd   time.Time
+}
+
+// NewClipIterator creates a new ClipIterator.
+func NewClipIterator(iter Iterator, minStart, maxEnd time.Time) *ClipIterator {
+	return &ClipIterator{
+		iter:     iter,
+		minStart: minStart,
+		maxEnd:   maxEnd,
+	}
+}
+
+// Next returns the next interval, clipped to the range.  The result
+// is a copy, so clipping never changes the underlying interval.
+func (iter *ClipIterator) Next() *interval.Interval {
+	for {
+		iv := iter.iter.Next()
+		if iv == nil {
+			return nil
+		}
+		start := util.MaxTime(iv.Start, iter.minStart)
+		end := util.MinTime(iv.End, iter.maxEnd)
+		if !end.After(start) {
+			continue
+		}
+		clipped := *iv
+		clipped.Start = start
+		clipped.End = end
+		return &clipped
+	}
+}
+
+// sliceIterator is an iterator over a slice of intervals.
+type sliceIterator struct {
+	ivs []*interval.Interval
+}
+
+// Next returns the next interval in the slice.
+func (iter *sliceIterator) Next() *interval.Interval {
+	if len(iter.ivs) == 0 {
+		return nil
+	}
+	iv := iter.ivs[0]
+	iter.ivs = iter.ivs[1:]
+	return iv
+}
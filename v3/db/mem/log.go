@@ -0,0 +1,214 @@
+package mem
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/go-memdb"
+	. "github.com/stevegt/goadapt"
+	"github.com/stevegt/timectl/v3/db"
+	"github.com/stevegt/timectl/v3/interval"
+)
+
+// Log record operations.  Each log record is an operation byte
+// followed by an interval encoded with db.EncodeInterval.
+const (
+	opInsert byte = iota + 1
+	opDelete
+)
+
+// WithLog returns an Option that makes the database durable by
+// appending every committed change to the write-ahead log file at
+// path.  When the database is created, NewMem loads the snapshot
+// written by Compact, if any, and then replays the log.  Payloads are
+// serialized with codec; if codec is nil, db.GobCodec is used.
+func WithLog(path string, codec db.Codec) Option {
+	return func(m *Mem) {
+		if codec == nil {
+			codec = db.GobCodec{}
+		}
+		m.logPath = path
+		m.codec = codec
+	}
+}
+
+// snapPath returns the path of the snapshot file written by Compact.
+func (m *Mem) snapPath() string {
+	return m.logPath + ".snap"
+}
+
+// openLog loads the snapshot and replays the write-ahead log, then
+// opens the log for appending.
+func (m *Mem) openLog() (err error) {
+	defer Return(&err)
+
+	tx := m.memdb.Txn(true)
+	defer tx.Abort()
+
+	// load the snapshot, if any
+	snap, err := os.Open(m.snapPath())
+	if err == nil {
+		err = load(tx, snap, m.codec)
+		snap.Close()
+		Ck(err)
+	} else if !os.IsNotExist(err) {
+		Ck(err)
+	}
+
+	// replay the log, then drop any partial record left at the end
+	// by a crash in the middle of a write
+	log, err := os.OpenFile(m.logPath, os.O_RDWR|os.O_CREATE, 0600)
+	Ck(err)
+	good, err := replay(tx, log, m.codec)
+	if err == nil {
+		err = log.Truncate(good)
+	}
+	cerr := log.Close()
+	Ck(err)
+	Ck(cerr)
+
+	m.log, err = os.OpenFile(m.logPath, os.O_WRONLY|os.O_APPEND, 0600)
+	Ck(err)
+	tx.Commit()
+	return
+}
+
+// replay applies the records in the log r to tx.  It returns the
+// length of the valid part of the log.  A truncated or corrupt record
+// is treated as the end of the log, since that is what a crash during
+// a write leaves behind.
+func replay(tx *memdb.Txn, r io.Reader, codec db.Codec) (good int64, err error) {
+	defer Return(&err)
+
+	br := bufio.NewReader(r)
+	for {
+		buf, err := readRecord(br)
+		if err == io.EOF || err == io.ErrUnexpectedEOF || errors.Is(err, errCorrupt) {
+			return good, nil
+		}
+		Ck(err)
+		Assert(len(buf) > 0, "empty log record")
+
+		iv, err := db.DecodeInterval(buf[1:], codec)
+		Ck(err)
+		switch buf[0] {
+		case opInsert:
+			err = tx.Insert("interval", iv)
+			Ck(err)
+		case opDelete:
+			// the interval may already be gone if we crashed
+			// during Compact after writing the snapshot
+			err = tx.Delete("interval", iv)
+			if err != memdb.ErrNotFound {
+				Ck(err)
+			}
+		default:
+			return good, fmt.Errorf("unknown log operation %d", buf[0])
+		}
+		good += int64(recordHeaderLen + len(buf))
+	}
+}
+
+// logRecord returns the log record for an operation on an interval,
+// or nil if the database has no log.  Callers encode the record
+// before changing the database, so that an interval that can't be
+// logged is never stored, and append it to the transaction's log
+// buffer after the change succeeds.
+func (tx *MemTx) logRecord(op byte, iv *interval.Interval) (rec []byte, err error) {
+	defer Return(&err)
+	if tx.mem == nil || tx.mem.log == nil {
+		return
+	}
+	buf, err := db.EncodeInterval(iv, tx.mem.codec)
+	Ck(err)
+	var b bytes.Buffer
+	err = writeRecord(&b, append([]byte{op}, buf...))
+	Ck(err)
+	return b.Bytes(), nil
+}
+
+// appendLog appends records to the log and syncs it to disk.  If the
+// write fails, the log is truncated back to its previous size, so
+// that a later commit doesn't follow a partial record that replay
+// would take for the end of the log.  If that fails too, the database
+// refuses all further commits.
+func (m *Mem) appendLog(records []byte) (err error) {
+	defer Return(&err)
+	if m.logErr != nil {
+		return fmt.Errorf("write-ahead log is unusable after an earlier failure: %w", m.logErr)
+	}
+	info, err := m.log.Stat()
+	Ck(err)
+	_, err = m.log.Write(records)
+	if err == nil {
+		err = m.log.Sync()
+	}
+	if err != nil {
+		terr := m.log.Truncate(info.Size())
+		if terr == nil {
+			terr = m.log.Sync()
+		}
+		if terr != nil {
+			m.logErr = err
+		}
+		return err
+	}
+	return
+}
+
+// Compact writes a snapshot of the database next to the write-ahead
+// log and then empties the log.  Write transactions block until
+// Compact is done.  If the process crashes during Compact, NewMem
+// replays the whole log on top of whichever snapshot it finds;
+// replaying is idempotent, so no committed changes are lost.
+func (m *Mem) Compact() (err error) {
+	defer Return(&err)
+
+	if m.log == nil {
+		return fmt.Errorf("database has no write-ahead log")
+	}
+
+	// holding a write transaction keeps other writers out
+	tx := m.memdb.Txn(true)
+	defer tx.Abort()
+
+	// write the snapshot to a temporary file and rename it into
+	// place so that a crash never leaves a partial snapshot
+	tmpPath := m.snapPath() + ".tmp"
+	f, err := os.Create(tmpPath)
+	Ck(err)
+	err = snapshot(tx, f, m.codec)
+	if err == nil {
+		err = f.Sync()
+	}
+	cerr := f.Close()
+	Ck(err)
+	Ck(cerr)
+	err = os.Rename(tmpPath, m.snapPath())
+	Ck(err)
+
+	// sync the directory so that the rename is on disk before the
+	// log is emptied; otherwise a crash could leave the old snapshot
+	// next to an empty log
+	dir, err := os.Open(filepath.Dir(m.snapPath()))
+	Ck(err)
+	err = dir.Sync()
+	cerr = dir.Close()
+	Ck(err)
+	Ck(cerr)
+
+	err = m.log.Truncate(0)
+	Ck(err)
+	err = m.log.Sync()
+	Ck(err)
+
+	// the snapshot holds only committed changes, so whatever a
+	// failed write left in the log is gone
+	m.logErr = nil
+	return
+}
@@ -1,20 +1,45 @@
 package mem
 
 import (
+	"os"
+
 	"github.com/hashicorp/go-memdb"
 	. "github.com/stevegt/goadapt"
+	"github.com/stevegt/timectl/v3/db"
 )
 
+// Mem must satisfy the db.Db interface.
+var _ db.Db = (*Mem)(nil)
+
 // Mem is an in-memory database.
 type Mem struct {
 	memdb *memdb.MemDB
+	// logPath is the path of the write-ahead log, or empty if the
+	// database is not logged.  See WithLog.
+	logPath string
+	// log is the open write-ahead log file.
+	log *os.File
+	// logErr is the error from a failed log write that could not be
+	// rolled back.  Once it is set, all commits fail, since the log
+	// may end with a partial record.
+	logErr error
+	// codec serializes payloads in the log and snapshot files.
+	codec db.Codec
 }
 
-// NewMemDb creates a new in-memory database.
-func NewMem() (mem *Mem, err error) {
+// Option configures a database created by NewMem.
+type Option func(*Mem)
+
+// NewMem creates a new in-memory database.
+func NewMem(opts ...Option) (mem *Mem, err error) {
 	defer Return(&err)
 
-	// Create the DB schema
+	// Create the DB schema.  The start and end indexes are not
+	// unique, so go-memdb appends the id to each key; this keeps
+	// intervals that share a start or end time from overwriting each
+	// other in the index while preserving time order.  The
+	// resource_start and resource_end indexes order intervals by
+	// resource and then by time, for the Find* methods.
 	schema := &memdb.DBSchema{
 		Tables: map[string]*memdb.TableSchema{
 			"interval": &memdb.TableSchema{
@@ -27,14 +52,34 @@ func NewMem() (mem *Mem, err error) {
 					},
 					"start": &memdb.IndexSchema{
 						Name:    "start",
-						Unique:  true,
+						Unique:  false,
 						Indexer: &TimeFieldIndex{Field: "Start"},
 					},
 					"end": &memdb.IndexSchema{
 						Name:    "end",
-						Unique:  true,
+						Unique:  false,
 						Indexer: &TimeFieldIndex{Field: "End"},
 					},
+					"resource_start": &memdb.IndexSchema{
+						Name:   "resource_start",
+						Unique: false,
+						Indexer: &memdb.CompoundIndex{
+							Indexes: []memdb.Indexer{
+								&ResourceFieldIndex{Field: "Resource"},
+								&TimeFieldIndex{Field: "Start"},
+							},
+						},
+					},
+					"resource_end": &memdb.IndexSchema{
+						Name:   "resource_end",
+						Unique: false,
+						Indexer: &memdb.CompoundIndex{
+							Indexes: []memdb.Indexer{
+								&ResourceFieldIndex{Field: "Resource"},
+								&TimeFieldIndex{Field: "End"},
+							},
+						},
+					},
 					"priority": &memdb.IndexSchema{
 						Name:    "priority",
 						Unique:  false,
@@ -49,17 +94,30 @@ func NewMem() (mem *Mem, err error) {
 	hdb, err := memdb.NewMemDB(schema)
 	Ck(err)
 	mem = &Mem{memdb: hdb}
+	for _, opt := range opts {
+		opt(mem)
+	}
+
+	if mem.logPath != "" {
+		err = mem.openLog()
+		Ck(err)
+	}
 	return
 }
 
 // NewTx returns a transaction for the database.  If the write
 // parameter is true, the transaction is a write transaction.
-func (m *Mem) NewTx(write bool) *MemTx {
-	return &MemTx{tx: m.memdb.Txn(write)}
+func (m *Mem) NewTx(write bool) db.Tx {
+	return &MemTx{tx: m.memdb.Txn(write), mem: m}
 }
 
 // Close closes the database.  In the case of an in-memory database,
-// this just releases the resources.
-func (m *Mem) Close() {
+// this just releases the resources, including the write-ahead log
+// file if there is one.
+func (m *Mem) Close() (err error) {
+	if m.log != nil {
+		err = m.log.Close()
+	}
 	*m = Mem{}
+	return
 }
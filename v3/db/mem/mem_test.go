@@ -1,10 +1,16 @@
 package mem
 
 import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stevegt/timectl/v3/db"
+	"github.com/stevegt/timectl/v3/db/dbtest"
 
 	"github.com/davecgh/go-spew/spew"
 	. "github.com/stevegt/goadapt"
@@ -81,3 +87,321 @@ func TestMemDbFind(t *testing.T) {
 }
 
 // XXX test payload preservation
+
+func TestMemDbConflict(t *testing.T) {
+	// open a new memdb
+	memdb, err := NewMem()
+	Tassert(t, err == nil, "NewMemDb() failed: %v", err)
+
+	// get a write transaction
+	tx := memdb.NewTx(true)
+
+	// add several intervals
+	i0900_1000 := db.Tadd(tx, 10, "2024-01-01T09:00:00", "2024-01-01T10:00:00", 2.0)
+	i1000_1100 := db.Tadd(tx, 20, "2024-01-01T10:00:00", "2024-01-01T11:00:00", 3.0)
+	db.Tadd(tx, 30, "2024-01-01T12:00:00", "2024-01-01T13:00:00", 1.0)
+
+	// try to add an interval that overlaps the first two
+	start, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T09:30:00")
+	Ck(err)
+	end, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T10:30:00")
+	Ck(err)
+	iv := interval.NewInterval(40, start, end, 1.0)
+	err = tx.Add(iv)
+	Tassert(t, err != nil, "Add() should have failed")
+	var cerr *db.ConflictError
+	Tassert(t, errors.As(err, &cerr), "expected ConflictError, got %v", err)
+	Tassert(t, cerr.Interval == iv, "expected interval %v, got %v", iv, cerr.Interval)
+	Tassert(t, len(cerr.Conflicts) == 2, "expected 2 conflicts, got %v", spew.Sdump(cerr.Conflicts))
+	Tassert(t, i0900_1000.Equal(cerr.Conflicts[0]), "expected interval %v, got %v", i0900_1000, cerr.Conflicts[0])
+	Tassert(t, i1000_1100.Equal(cerr.Conflicts[1]), "expected interval %v, got %v", i1000_1100, cerr.Conflicts[1])
+
+	// the rejected interval must not have been added
+	ivs, err := tx.FindFwd(start, end, 99.0)
+	Tassert(t, err == nil, "Find() failed: %v", err)
+	Tassert(t, len(ivs) == 2, "expected 2 intervals, got %v", spew.Sdump(ivs))
+
+	// a free interval does not conflict with anything
+	free := interval.NewInterval(50, start, end, 0)
+	err = tx.Add(free)
+	Tassert(t, err == nil, "Add() failed: %v", err)
+
+	// an interval in the gap does not conflict either
+	db.Tadd(tx, 60, "2024-01-01T11:00:00", "2024-01-01T12:00:00", 1.0)
+}
+
+func TestMemDbSharedBoundaries(t *testing.T) {
+	// open a new memdb
+	memdb, err := NewMem()
+	Tassert(t, err == nil, "NewMemDb() failed: %v", err)
+
+	// get a write transaction
+	tx := memdb.NewTx(true)
+
+	// add a free layer and a busy layer that share start and end
+	// times -- free intervals don't conflict with busy intervals
+	free0900_1200 := db.Tadd(tx, 1, "2024-01-01T09:00:00", "2024-01-01T12:00:00", 0.0)
+	busy0900_1000 := db.Tadd(tx, 2, "2024-01-01T09:00:00", "2024-01-01T10:00:00", 1.0)
+	busy1100_1200 := db.Tadd(tx, 3, "2024-01-01T11:00:00", "2024-01-01T12:00:00", 1.0)
+
+	start, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T09:00:00")
+	Ck(err)
+	end, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T12:00:00")
+	Ck(err)
+
+	// all three stored intervals must be found going forward; the
+	// gap between the busy intervals is covered by the stored free
+	// interval, so no synthetic free interval is needed.  Intervals
+	// 1 and 3 end at the same time, so their order is not checked.
+	ivs, err := tx.FindFwd(start, end, 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	Tassert(t, len(ivs) == 3, "FindFwd() failed: expected 3 intervals, got %v", spew.Sdump(ivs))
+	stored := map[uint64]*interval.Interval{1: free0900_1200, 2: busy0900_1000, 3: busy1100_1200}
+	found := map[uint64]bool{}
+	for _, iv := range ivs {
+		Tassert(t, iv.Id != 0, "expected no synthetic free interval, got %v", spew.Sdump(ivs))
+		Tassert(t, stored[iv.Id] != nil && stored[iv.Id].Equal(iv), "unexpected interval %v", iv)
+		found[iv.Id] = true
+	}
+	Tassert(t, len(found) == 3, "FindFwd() failed: expected ids 1, 2, and 3, got %v", spew.Sdump(ivs))
+
+	// ... and going backward
+	ivs, err = tx.FindRev(start, end, 99.0)
+	Tassert(t, err == nil, "FindRev() failed: %v", err)
+	ids := map[uint64]bool{}
+	for _, iv := range ivs {
+		ids[iv.Id] = true
+	}
+	Tassert(t, ids[1] && ids[2] && ids[3], "FindRev() failed: expected ids 1, 2, and 3, got %v", spew.Sdump(ivs))
+
+	// deleting one of them must leave the others in the indexes
+	err = tx.Delete(busy0900_1000)
+	Tassert(t, err == nil, "Delete() failed: %v", err)
+	ivs, err = tx.FindFwd(start, end, 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	ids = map[uint64]bool{}
+	for _, iv := range ivs {
+		ids[iv.Id] = true
+	}
+	Tassert(t, len(ivs) == 2 && ids[1] && ids[3], "FindFwd() failed: expected ids 1 and 3, got %v", spew.Sdump(ivs))
+}
+
+func TestMemConformance(t *testing.T) {
+	dbtest.Run(t, func() (db.Db, error) {
+		return NewMem()
+	})
+}
+
+// meeting is a payload type for the snapshot tests.
+type meeting struct {
+	Title     string
+	Attendees []string
+}
+
+func TestMemSnapshot(t *testing.T) {
+	gob.Register(meeting{})
+
+	memdb, err := NewMem()
+	Tassert(t, err == nil, "NewMemDb() failed: %v", err)
+	start, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T09:00:00")
+	Ck(err)
+	end, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T12:00:00")
+	Ck(err)
+	tx := memdb.NewTx(true)
+	// set the payload before adding the interval; the stored
+	// interval must not be changed in place
+	i0900_1000 := interval.NewInterval(10, start, start.Add(time.Hour), 2.0)
+	i0900_1000.Payload = meeting{Title: "standup", Attendees: []string{"alice", "bob"}}
+	err = tx.Add(i0900_1000)
+	Tassert(t, err == nil, "Add() failed: %v", err)
+	i1100_1200 := db.Tadd(tx, 20, "2024-01-01T11:00:00", "2024-01-01T12:00:00", 3.0)
+	err = tx.Commit()
+	Tassert(t, err == nil, "Commit() failed: %v", err)
+
+	// take a snapshot and restore it into a new database
+	var buf bytes.Buffer
+	err = memdb.Snapshot(&buf, nil)
+	Tassert(t, err == nil, "Snapshot() failed: %v", err)
+	restored, err := Restore(&buf, nil)
+	Tassert(t, err == nil, "Restore() failed: %v", err)
+
+	tx = restored.NewTx(false)
+	ivs, err := tx.FindFwd(start, end, 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	Tassert(t, len(ivs) == 3, "FindFwd() failed: expected 3 intervals, got %v", spew.Sdump(ivs))
+	Tassert(t, ivs[0].Id == 10 && i0900_1000.Equal(ivs[0]), "expected interval %v, got %v", i0900_1000, ivs[0])
+	Tassert(t, ivs[0].Priority == 2.0, "expected priority 2, got %v", ivs[0].Priority)
+	m, ok := ivs[0].Payload.(meeting)
+	Tassert(t, ok && m.Title == "standup" && len(m.Attendees) == 2, "expected payload %v, got %v", i0900_1000.Payload, ivs[0].Payload)
+	Tassert(t, ivs[2].Id == 20 && i1100_1200.Equal(ivs[2]), "expected interval %v, got %v", i1100_1200, ivs[2])
+	Tassert(t, ivs[2].Payload == nil, "expected nil payload, got %v", ivs[2].Payload)
+
+	// the restored database enforces conflicts like any other
+	tx = restored.NewTx(true)
+	iv := interval.NewInterval(30, start, end, 1.0)
+	err = tx.Add(iv)
+	Tassert(t, err != nil, "Add() should have failed")
+
+	// a truncated snapshot is an error
+	buf.Reset()
+	err = memdb.Snapshot(&buf, nil)
+	Tassert(t, err == nil, "Snapshot() failed: %v", err)
+	_, err = Restore(bytes.NewReader(buf.Bytes()[:buf.Len()-1]), nil)
+	Tassert(t, err != nil, "Restore() of a truncated snapshot should have failed")
+}
+
+func TestMemLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	start, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T09:00:00")
+	Ck(err)
+	end, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T14:00:00")
+	Ck(err)
+
+	// ids returns the ids of the busy intervals in the database
+	ids := func(m *Mem) (ids []uint64) {
+		tx := m.NewTx(false)
+		defer tx.Abort()
+		ivs, err := tx.FindFwd(start, end, 99.0)
+		Tassert(t, err == nil, "FindFwd() failed: %v", err)
+		for _, iv := range ivs {
+			if iv.Busy() {
+				ids = append(ids, iv.Id)
+			}
+		}
+		return
+	}
+
+	// make some committed and some aborted changes
+	memdb, err := NewMem(WithLog(path, nil))
+	Tassert(t, err == nil, "NewMem() failed: %v", err)
+	tx := memdb.NewTx(true)
+	db.Tadd(tx, 10, "2024-01-01T09:00:00", "2024-01-01T10:00:00", 2.0)
+	i1000_1100 := db.Tadd(tx, 20, "2024-01-01T10:00:00", "2024-01-01T11:00:00", 3.0)
+	err = tx.Commit()
+	Tassert(t, err == nil, "Commit() failed: %v", err)
+	tx = memdb.NewTx(true)
+	err = tx.Delete(i1000_1100)
+	Tassert(t, err == nil, "Delete() failed: %v", err)
+	db.Tadd(tx, 30, "2024-01-01T11:00:00", "2024-01-01T12:00:00", 1.0)
+	err = tx.Commit()
+	Tassert(t, err == nil, "Commit() failed: %v", err)
+	tx = memdb.NewTx(true)
+	db.Tadd(tx, 40, "2024-01-01T12:00:00", "2024-01-01T13:00:00", 1.0)
+	tx.Abort()
+	err = memdb.Close()
+	Tassert(t, err == nil, "Close() failed: %v", err)
+
+	// replay the log
+	memdb, err = NewMem(WithLog(path, nil))
+	Tassert(t, err == nil, "NewMem() failed: %v", err)
+	got := ids(memdb)
+	Tassert(t, len(got) == 2 && got[0] == 10 && got[1] == 30, "expected ids [10 30], got %v", got)
+
+	// compact, make more changes, and replay the snapshot and log
+	err = memdb.Compact()
+	Tassert(t, err == nil, "Compact() failed: %v", err)
+	tx = memdb.NewTx(true)
+	db.Tadd(tx, 50, "2024-01-01T13:00:00", "2024-01-01T14:00:00", 1.0)
+	err = tx.Commit()
+	Tassert(t, err == nil, "Commit() failed: %v", err)
+	err = memdb.Close()
+	Tassert(t, err == nil, "Close() failed: %v", err)
+	memdb, err = NewMem(WithLog(path, nil))
+	Tassert(t, err == nil, "NewMem() failed: %v", err)
+	got = ids(memdb)
+	Tassert(t, len(got) == 3 && got[0] == 10 && got[1] == 30 && got[2] == 50, "expected ids [10 30 50], got %v", got)
+	err = memdb.Close()
+	Tassert(t, err == nil, "Close() failed: %v", err)
+
+	// simulate a crash in the middle of a log write
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	Ck(err)
+	_, err = f.Write([]byte{0, 0, 1, 0, 0xde, 0xad})
+	Ck(err)
+	err = f.Close()
+	Ck(err)
+	memdb, err = NewMem(WithLog(path, nil))
+	Tassert(t, err == nil, "NewMem() failed: %v", err)
+	got = ids(memdb)
+	Tassert(t, len(got) == 3, "expected 3 intervals after recovery, got %v", got)
+
+	// the partial record is gone, so new records are readable
+	tx = memdb.NewTx(true)
+	db.Tadd(tx, 60, "2024-01-01T08:00:00", "2024-01-01T09:00:00", 1.0)
+	err = tx.Commit()
+	Tassert(t, err == nil, "Commit() failed: %v", err)
+	err = memdb.Close()
+	Tassert(t, err == nil, "Close() failed: %v", err)
+	memdb, err = NewMem(WithLog(path, nil))
+	Tassert(t, err == nil, "NewMem() failed: %v", err)
+	defer memdb.Close()
+	tx = memdb.NewTx(false)
+	defer tx.Abort()
+	ivs, err := tx.FindFwd(start.Add(-time.Hour), start, 99.0)
+	Tassert(t, err == nil, "FindFwd() failed: %v", err)
+	Tassert(t, len(ivs) == 1 && ivs[0].Id == 60, "expected interval 60, got %v", spew.Sdump(ivs))
+}
+
+func TestMemLogFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	memdb, err := NewMem(WithLog(path, nil))
+	Tassert(t, err == nil, "NewMem() failed: %v", err)
+	tx := memdb.NewTx(true)
+	db.Tadd(tx, 10, "2024-01-01T09:00:00", "2024-01-01T10:00:00", 2.0)
+	err = tx.Commit()
+	Tassert(t, err == nil, "Commit() failed: %v", err)
+
+	// an interval whose payload can't be encoded for the log is not
+	// stored
+	type unregistered struct{ N int }
+	tx = memdb.NewTx(true)
+	bad := interval.NewInterval(15, time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC), time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC), 1.0)
+	bad.Payload = unregistered{1}
+	err = tx.Add(bad)
+	Tassert(t, err != nil, "Add() with an unregistered payload type should have failed")
+	_, err = tx.Get(bad.Id)
+	Tassert(t, errors.Is(err, db.ErrNotFound), "expected db.ErrNotFound, got %v", err)
+	err = tx.Commit()
+	Tassert(t, err == nil, "Commit() failed: %v", err)
+
+	// make log writes and truncation fail by swapping in a
+	// read-only file
+	log := memdb.log
+	memdb.log, err = os.Open(path)
+	Ck(err)
+	tx = memdb.NewTx(true)
+	db.Tadd(tx, 20, "2024-01-01T10:00:00", "2024-01-01T11:00:00", 2.0)
+	err = tx.Commit()
+	Tassert(t, err != nil, "Commit() should have failed")
+	err = memdb.log.Close()
+	Ck(err)
+	memdb.log = log
+
+	// the log couldn't be rolled back, so later commits are refused
+	// even though the log is writable again
+	tx = memdb.NewTx(true)
+	db.Tadd(tx, 30, "2024-01-01T11:00:00", "2024-01-01T12:00:00", 2.0)
+	err = tx.Commit()
+	Tassert(t, err != nil, "Commit() should have failed")
+
+	// compacting empties the log, so commits work again
+	err = memdb.Compact()
+	Tassert(t, err == nil, "Compact() failed: %v", err)
+	tx = memdb.NewTx(true)
+	db.Tadd(tx, 40, "2024-01-01T12:00:00", "2024-01-01T13:00:00", 2.0)
+	err = tx.Commit()
+	Tassert(t, err == nil, "Commit() failed: %v", err)
+	err = memdb.Close()
+	Tassert(t, err == nil, "Close() failed: %v", err)
+
+	// only the successful commits survive
+	memdb, err = NewMem(WithLog(path, nil))
+	Tassert(t, err == nil, "NewMem() failed: %v", err)
+	defer memdb.Close()
+	rtx := memdb.NewTx(false)
+	defer rtx.Abort()
+	for id, expect := range map[uint64]bool{10: true, 15: false, 20: false, 30: false, 40: true} {
+		_, err := rtx.Get(id)
+		Tassert(t, (err == nil) == expect, "Get(%d): expected found %v, got %v", id, expect, err)
+	}
+}
@@ -0,0 +1,55 @@
+package mem
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+)
+
+// ResourceFieldIndex is an index that indexes resource name fields.
+// Unlike go-memdb's StringFieldIndex, it indexes the empty string,
+// which is the default resource.  Each key is the length of the name
+// followed by the name, so no name is a prefix of another name's key
+// and the intervals of each resource sort together.
+type ResourceFieldIndex struct {
+	Field string
+}
+
+// FromObject satisfies the go-memdb SingleIndexer interface.
+func (i *ResourceFieldIndex) FromObject(obj interface{}) (bool, []byte, error) {
+	v := reflect.ValueOf(obj)
+	v = reflect.Indirect(v) // Dereference the pointer if any
+
+	fv := v.FieldByName(i.Field)
+	if !fv.IsValid() {
+		return false, nil,
+			fmt.Errorf("field '%s' for %#v is invalid", i.Field, obj)
+	}
+	if fv.Kind() != reflect.String {
+		return false, nil, fmt.Errorf("field '%s' is not a string", i.Field)
+	}
+
+	return true, encodeResource(fv.String()), nil
+}
+
+// FromArgs satisfies the go-memdb Indexer interface.
+func (i *ResourceFieldIndex) FromArgs(args ...interface{}) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("must provide only a single argument")
+	}
+
+	resource, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("argument must be a string: %#v", args[0])
+	}
+
+	return encodeResource(resource), nil
+}
+
+// encodeResource encodes a resource name as its length followed by
+// the name.
+func encodeResource(resource string) []byte {
+	buf := make([]byte, 4, 4+len(resource))
+	binary.BigEndian.PutUint32(buf, uint32(len(resource)))
+	return append(buf, resource...)
+}
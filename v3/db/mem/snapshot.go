@@ -0,0 +1,154 @@
+package mem
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/hashicorp/go-memdb"
+	. "github.com/stevegt/goadapt"
+	"github.com/stevegt/timectl/v3/db"
+	"github.com/stevegt/timectl/v3/interval"
+)
+
+// snapshotMagic is written at the start of every snapshot.
+var snapshotMagic = []byte("timectl mem snapshot v1\n")
+
+// recordHeaderLen is the length of the header that writeRecord puts
+// in front of each record: a 4-byte length and a 4-byte CRC-32.
+const recordHeaderLen = 8
+
+// maxRecordLen is the largest record readRecord accepts.  A larger
+// length can only come from a corrupt header.
+const maxRecordLen = 1 << 28
+
+// errCorrupt is returned by readRecord if a record is corrupt.
+var errCorrupt = errors.New("corrupt record")
+
+// Snapshot writes all intervals in the database to w.  Payloads are
+// serialized with codec; if codec is nil, db.GobCodec is used.  The
+// snapshot is taken in a read transaction, so it is consistent even
+// if other goroutines are writing to the database.
+func (m *Mem) Snapshot(w io.Writer, codec db.Codec) (err error) {
+	defer Return(&err)
+
+	if codec == nil {
+		codec = db.GobCodec{}
+	}
+
+	tx := m.memdb.Txn(false)
+	defer tx.Abort()
+	return snapshot(tx, w, codec)
+}
+
+// snapshot writes all intervals visible in tx to w.
+func snapshot(tx *memdb.Txn, w io.Writer, codec db.Codec) (err error) {
+	defer Return(&err)
+
+	iter, err := tx.Get("interval", "id")
+	Ck(err)
+
+	bw := bufio.NewWriter(w)
+	_, err = bw.Write(snapshotMagic)
+	Ck(err)
+	for obj := iter.Next(); obj != nil; obj = iter.Next() {
+		buf, err := db.EncodeInterval(obj.(*interval.Interval), codec)
+		Ck(err)
+		err = writeRecord(bw, buf)
+		Ck(err)
+	}
+	return bw.Flush()
+}
+
+// Restore creates a new in-memory database containing the intervals
+// in a snapshot written by Snapshot.  Payloads are deserialized with
+// codec; if codec is nil, db.GobCodec is used.
+func Restore(r io.Reader, codec db.Codec) (m *Mem, err error) {
+	defer Return(&err)
+
+	if codec == nil {
+		codec = db.GobCodec{}
+	}
+
+	m, err = NewMem()
+	Ck(err)
+	tx := m.memdb.Txn(true)
+	defer tx.Abort()
+	err = load(tx, r, codec)
+	Ck(err)
+	tx.Commit()
+	return
+}
+
+// load inserts the intervals in a snapshot into tx.
+func load(tx *memdb.Txn, r io.Reader, codec db.Codec) (err error) {
+	defer Return(&err)
+
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(snapshotMagic))
+	_, err = io.ReadFull(br, magic)
+	Ck(err)
+	if !bytes.Equal(magic, snapshotMagic) {
+		return fmt.Errorf("not a timectl mem snapshot")
+	}
+
+	for {
+		buf, err := readRecord(br)
+		if err == io.EOF {
+			break
+		}
+		Ck(err)
+		iv, err := db.DecodeInterval(buf, codec)
+		Ck(err)
+		// the snapshot came from a consistent database, so there is
+		// no need to check for conflicts
+		err = tx.Insert("interval", iv)
+		Ck(err)
+	}
+	return
+}
+
+// writeRecord writes buf to w, framed by its length and checksum.
+func writeRecord(w io.Writer, buf []byte) (err error) {
+	defer Return(&err)
+	hdr := make([]byte, recordHeaderLen)
+	binary.BigEndian.PutUint32(hdr[0:4], uint32(len(buf)))
+	binary.BigEndian.PutUint32(hdr[4:8], crc32.ChecksumIEEE(buf))
+	_, err = w.Write(hdr)
+	Ck(err)
+	_, err = w.Write(buf)
+	Ck(err)
+	return
+}
+
+// readRecord reads a record written by writeRecord.  It returns
+// io.EOF if there are no more records, io.ErrUnexpectedEOF if the
+// last record is truncated, and errCorrupt if the length or checksum
+// is bad.
+func readRecord(r io.Reader) (buf []byte, err error) {
+	hdr := make([]byte, recordHeaderLen)
+	_, err = io.ReadFull(r, hdr)
+	if err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[0:4])
+	if n > maxRecordLen {
+		return nil, errCorrupt
+	}
+	buf = make([]byte, n)
+	_, err = io.ReadFull(r, buf)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(buf) != binary.BigEndian.Uint32(hdr[4:8]) {
+		return nil, errCorrupt
+	}
+	return buf, nil
+}
@@ -1,6 +1,8 @@
 package mem
 
 import (
+	"bytes"
+	"fmt"
 	"time"
 
 	"github.com/stevegt/timectl/v3/db"
@@ -10,35 +12,163 @@ import (
 	"github.com/stevegt/timectl/v3/interval"
 )
 
+// MemTx must satisfy the db.Tx interface.
+var _ db.Tx = (*MemTx)(nil)
+
 // MemTx is a transaction for the in-memory database.
 type MemTx struct {
-	tx *memdb.Txn
+	tx  *memdb.Txn
+	mem *Mem
+	// logBuf holds the log records for the changes made in the
+	// transaction until they are written to the log by Commit.
+	logBuf bytes.Buffer
+}
+
+// Add adds an interval to the database.  If there is already an
+// interval with the same id, it returns an error wrapping
+// db.ErrExists.  If the interval is busy and conflicts with any
+// existing busy intervals, it returns a *db.ConflictError listing
+// them.
+func (tx *MemTx) Add(iv *interval.Interval) (err error) {
+	defer Return(&err)
+	old, err := tx.get(iv.Id)
+	Ck(err)
+	if old != nil {
+		return fmt.Errorf("interval %d: %w", iv.Id, db.ErrExists)
+	}
+	err = tx.checkConflicts(iv)
+	Ck(err)
+	return tx.insert(iv)
+}
+
+// Update replaces the stored interval that has the same id as iv
+// with iv.  If no interval has that id, or iv does not end after it
+// starts, it returns an error.  If iv is busy and conflicts with any
+// other existing busy interval, it returns a *db.ConflictError.
+func (tx *MemTx) Update(iv *interval.Interval) (err error) {
+	defer Return(&err)
+	old, err := tx.get(iv.Id)
+	Ck(err)
+	if old == nil {
+		return fmt.Errorf("interval %d: %w", iv.Id, db.ErrNotFound)
+	}
+	if !iv.End.After(iv.Start) {
+		return fmt.Errorf("interval %d: end %v is not after start %v", iv.Id, iv.End, iv.Start)
+	}
+	err = tx.checkConflicts(iv)
+	Ck(err)
+	return tx.insert(iv)
+}
+
+// Move changes the start and end time of the interval with the given
+// id.  It fails in the same way as Update.
+func (tx *MemTx) Move(id uint64, start, end time.Time) (err error) {
+	defer Return(&err)
+	iv, err := tx.Get(id)
+	Ck(err)
+	if !end.After(start) {
+		return fmt.Errorf("interval %d: end %v is not after start %v", id, end, start)
+	}
+	iv.Start = start
+	iv.End = end
+	return tx.Update(iv)
+}
+
+// SetPriority sets the priority of the interval with the given id.
+// It fails in the same way as Update.
+func (tx *MemTx) SetPriority(id uint64, priority float64) (err error) {
+	defer Return(&err)
+	iv, err := tx.Get(id)
+	Ck(err)
+	iv.Priority = priority
+	return tx.Update(iv)
 }
 
-// Add adds an interval to the database.
-func (tx *MemTx) Add(iv *interval.Interval) error {
-	// XXX ensure that the interval does not conflict with any existing intervals
-	return tx.tx.Insert("interval", iv)
+// checkConflicts returns a *db.ConflictError if iv is busy and
+// conflicts with any existing busy intervals.
+func (tx *MemTx) checkConflicts(iv *interval.Interval) (err error) {
+	defer Return(&err)
+	if !iv.Busy() {
+		return
+	}
+	conflicts, err := db.FindConflicts(tx, iv)
+	Ck(err)
+	if len(conflicts) > 0 {
+		return &db.ConflictError{Interval: iv, Conflicts: conflicts}
+	}
+	return
+}
+
+// Get returns a copy of the interval with the given id.  If there is
+// no such interval, it returns an error wrapping db.ErrNotFound.
+func (tx *MemTx) Get(id uint64) (iv *interval.Interval, err error) {
+	defer Return(&err)
+	stored, err := tx.get(id)
+	Ck(err)
+	if stored == nil {
+		return nil, fmt.Errorf("interval %d: %w", id, db.ErrNotFound)
+	}
+	// stored intervals must not be modified in place, so return a
+	// copy
+	cp := *stored
+	return &cp, nil
+}
+
+// get returns the stored interval with the given id, or nil if there
+// is none.
+func (tx *MemTx) get(id uint64) (iv *interval.Interval, err error) {
+	defer Return(&err)
+	obj, err := tx.tx.First("interval", "id", id)
+	Ck(err)
+	if obj == nil {
+		return nil, nil
+	}
+	return obj.(*interval.Interval), nil
+}
+
+// insert inserts or replaces an interval and records the change for
+// the write-ahead log.
+func (tx *MemTx) insert(iv *interval.Interval) (err error) {
+	defer Return(&err)
+	rec, err := tx.logRecord(opInsert, iv)
+	Ck(err)
+	err = tx.tx.Insert("interval", iv)
+	Ck(err)
+	tx.logBuf.Write(rec)
+	return
 }
 
-// FindFwdIter returns an iterator for the intervals that intersect
-// with the given start and end time and are at or lower than the
-// given priority.  The results are sorted in ascending order by end
-// time.  The results include synthetic free intervals that represent
-// the time slots between the intervals.
+// FindFwdIter returns an iterator for the intervals on the default
+// resource that intersect with the given start and end time and are
+// at or lower than the given priority.  The results are sorted in
+// ascending order by end time.  The results include synthetic free
+// intervals that represent the time slots between the intervals.
 func (tx *MemTx) FindFwdIter(minStart, maxEnd time.Time, maxPriority float64) (iter db.Iterator, err error) {
-	return NewFindIterator(tx, true, minStart, maxEnd, maxPriority)
+	return tx.FindFwdIterIn("", minStart, maxEnd, maxPriority)
 }
 
 // FindRevIter is the same as FindFwdIter, but it returns the results
 // in descending order by start time.
 func (tx *MemTx) FindRevIter(minStart, maxEnd time.Time, maxPriority float64) (ivs db.Iterator, err error) {
-	return NewFindIterator(tx, false, minStart, maxEnd, maxPriority)
+	return tx.FindRevIterIn("", minStart, maxEnd, maxPriority)
+}
+
+// FindFwdIterIn is the same as FindFwdIter, but it searches the given
+// resource.
+func (tx *MemTx) FindFwdIterIn(resource string, minStart, maxEnd time.Time, maxPriority float64) (iter db.Iterator, err error) {
+	return NewFindIterator(tx, resource, true, minStart, maxEnd, maxPriority)
+}
+
+// FindRevIterIn is the same as FindRevIter, but it searches the given
+// resource.
+func (tx *MemTx) FindRevIterIn(resource string, minStart, maxEnd time.Time, maxPriority float64) (ivs db.Iterator, err error) {
+	return NewFindIterator(tx, resource, false, minStart, maxEnd, maxPriority)
 }
 
 // FindFwd is a convenience method that returns the results of
 // FindFwdIter as a slice.
 func (tx *MemTx) FindFwd(minStart, maxEnd time.Time, maxPriority float64) (ivs []*interval.Interval, err error) {
+	defer Return(&err)
 	iter, err := tx.FindFwdIter(minStart, maxEnd, maxPriority)
 	Ck(err)
 	for {
@@ -54,6 +184,7 @@ func (tx *MemTx) FindFwd(minStart, maxEnd time.Time, maxPriority float64) (ivs [
 // FindRev is a convenience method that returns the results of
 // FindRevIter as a slice.
 func (tx *MemTx) FindRev(minStart, maxEnd time.Time, maxPriority float64) (ivs []*interval.Interval, err error) {
+	defer Return(&err)
 	iter, err := tx.FindRevIter(minStart, maxEnd, maxPriority)
 	Ck(err)
 	for {
@@ -66,18 +197,106 @@ func (tx *MemTx) FindRev(minStart, maxEnd time.Time, maxPriority float64) (ivs [
 	return
 }
 
+// At returns the intervals on the default resource that contain the
+// given time, or a synthetic free interval if there are none.
+func (tx *MemTx) At(t time.Time) (ivs []*interval.Interval, err error) {
+	return db.AtIn(tx, "", t)
+}
+
+// Next returns the first busy interval on the default resource that
+// starts after the given time, or nil if there is none.
+func (tx *MemTx) Next(t time.Time) (iv *interval.Interval, err error) {
+	return db.NextIn(tx, "", t)
+}
+
+// Prev returns the last busy interval on the default resource that
+// ends on or before the given time, or nil if there is none.
+func (tx *MemTx) Prev(t time.Time) (iv *interval.Interval, err error) {
+	return db.PrevIn(tx, "", t)
+}
+
+// IterateDown returns an iterator over all intervals in descending
+// order of priority.
+func (tx *MemTx) IterateDown() (iter db.Iterator, err error) {
+	return tx.iterate("priority", true)
+}
+
+// IterateUp returns an iterator over all intervals in ascending order
+// of priority.
+func (tx *MemTx) IterateUp() (iter db.Iterator, err error) {
+	return tx.iterate("priority", false)
+}
+
+// IterateForward returns an iterator over all intervals in ascending
+// order of start time.
+func (tx *MemTx) IterateForward() (iter db.Iterator, err error) {
+	return tx.iterate("start", false)
+}
+
+// IterateBackward returns an iterator over all intervals in
+// descending order of start time.
+func (tx *MemTx) IterateBackward() (iter db.Iterator, err error) {
+	return tx.iterate("start", true)
+}
+
+// iterate returns an iterator over all intervals in the order of the
+// given index, reversed if reverse is true.
+func (tx *MemTx) iterate(index string, reverse bool) (iter db.Iterator, err error) {
+	defer Return(&err)
+	var results memdb.ResultIterator
+	if reverse {
+		results, err = tx.tx.GetReverse("interval", index)
+	} else {
+		results, err = tx.tx.Get("interval", index)
+	}
+	Ck(err)
+	return &resultIterator{iter: results}, nil
+}
+
 // Delete removes an interval from the database.  If the interval
-// interval does not exist, it returns an error.
-func (tx *MemTx) Delete(iv *interval.Interval) error {
-	return tx.tx.Delete("interval", iv)
+// does not exist, it returns an error wrapping db.ErrNotFound.
+func (tx *MemTx) Delete(iv *interval.Interval) (err error) {
+	defer Return(&err)
+	rec, err := tx.logRecord(opDelete, iv)
+	Ck(err)
+	err = tx.tx.Delete("interval", iv)
+	if err == memdb.ErrNotFound {
+		return fmt.Errorf("interval %d: %w", iv.Id, db.ErrNotFound)
+	}
+	Ck(err)
+	tx.logBuf.Write(rec)
+	return
+}
+
+// DeleteById removes the interval with the given id from the
+// database.  If there is no such interval, it returns an error
+// wrapping db.ErrNotFound.
+func (tx *MemTx) DeleteById(id uint64) (err error) {
+	defer Return(&err)
+	iv, err := tx.Get(id)
+	Ck(err)
+	return tx.Delete(iv)
 }
 
-// Commit commits the transaction.
-func (tx *MemTx) Commit() {
+// Commit commits the transaction.  If the database has a write-ahead
+// log, the changes are appended to the log and synced to disk first;
+// if that fails, the transaction is aborted and the error returned.
+func (tx *MemTx) Commit() (err error) {
+	defer Return(&err)
+	if tx.logBuf.Len() > 0 {
+		err = tx.mem.appendLog(tx.logBuf.Bytes())
+		if err != nil {
+			tx.tx.Abort()
+			Ck(err)
+		}
+		tx.logBuf.Reset()
+	}
 	tx.tx.Commit()
+	return
 }
 
 // Abort aborts the transaction.
 func (tx *MemTx) Abort() {
+	tx.logBuf.Reset()
 	tx.tx.Abort()
 }
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+	"github.com/stevegt/timectl/v3/interval"
+	"github.com/stevegt/timectl/v3/util"
+)
+
+// CommonSet is a time slot in which several resources are all
+// available, as found by FindCommonSet.
+type CommonSet struct {
+	Start time.Time
+	End   time.Time
+	// Sets maps each resource to the intervals on that resource that
+	// intersect with the slot, including synthetic free intervals, in
+	// ascending order of start time.  The busy intervals are the ones
+	// that would be displaced by using the slot.
+	Sets map[string][]*interval.Interval
+}
+
+// FindCommonSet finds a time slot of the given duration between the
+// given start and end times in which all of the given resources are
+// available -- that is, each resource is free or only has intervals
+// at or below the given priority.  The first parameter indicates
+// whether the slot should be the first or last one found within the
+// given time range, as with FindSet.  If there is no such slot, it
+// returns nil.
+func FindCommonSet(tx Tx, resources []string, first bool, minStart, maxEnd time.Time, minDuration time.Duration, maxPriority float64) (common *CommonSet, err error) {
+	defer Return(&err)
+
+	if len(resources) == 0 {
+		return nil, fmt.Errorf("no resources given")
+	}
+
+	// intersect the availability of the resources
+	var avail interval.IntervalSet
+	for i, resource := range resources {
+		ravail, err := availability(tx, resource, minStart, maxEnd, maxPriority)
+		Ck(err)
+		if i == 0 {
+			avail = ravail
+		} else {
+			avail = avail.Intersection(ravail)
+		}
+	}
+
+	// pick the first or last run that is long enough
+	for i := range avail {
+		run := avail[len(avail)-1-i]
+		if first {
+			run = avail[i]
+		}
+		if run.Duration() < minDuration {
+			continue
+		}
+		if first {
+			common = &CommonSet{Start: run.Start, End: run.Start.Add(minDuration)}
+		} else {
+			common = &CommonSet{Start: run.End.Add(-minDuration), End: run.End}
+		}
+		break
+	}
+	if common == nil {
+		return nil, nil
+	}
+
+	common.Sets = make(map[string][]*interval.Interval)
+	for _, resource := range resources {
+		iter, err := tx.FindFwdIterIn(resource, common.Start, common.End, maxPriority)
+		Ck(err)
+		for iv := iter.Next(); iv != nil; iv = iter.Next() {
+			common.Sets[resource] = append(common.Sets[resource], iv)
+		}
+	}
+	return
+}
+
+// QuorumSlot is a time window in which a quorum of resources are
+// all available, as found by FindQuorum.
+type QuorumSlot struct {
+	// Start and End bound the window in which all of the available
+	// resources are available.  It is at least as long as the
+	// duration searched for.
+	Start time.Time
+	End   time.Time
+	// Available lists the available resources, in the order they
+	// were given to FindQuorum.
+	Available []string
+}
+
+// FindQuorum finds the time slots of the given duration between the
+// given start and end times in which at least quorum of the given
+// resources are available, using the same meaning of available as
+// FindCommonSet.  Each result is the longest window, starting at its
+// Start time, in which a particular group of resources is available,
+// and lists that group.  The results are in ascending order of start
+// time.
+func FindQuorum(tx Tx, resources []string, quorum int, minStart, maxEnd time.Time, minDuration time.Duration, maxPriority float64) (slots []QuorumSlot, err error) {
+	defer Return(&err)
+
+	if quorum < 1 {
+		return nil, fmt.Errorf("quorum must be at least 1, got %d", quorum)
+	}
+
+	// a slot can always be moved earlier until it starts at the
+	// start of some resource's availability, so those are the only
+	// start times we need to try
+	avail := make([]interval.IntervalSet, len(resources))
+	var starts []time.Time
+	for i, resource := range resources {
+		avail[i], err = availability(tx, resource, minStart, maxEnd, maxPriority)
+		Ck(err)
+		for _, run := range avail[i] {
+			starts = append(starts, run.Start)
+		}
+	}
+	sort.Slice(starts, func(a, b int) bool { return starts[a].Before(starts[b]) })
+
+	for _, start := range starts {
+		if len(slots) > 0 && slots[len(slots)-1].Start.Equal(start) {
+			// duplicate start time
+			continue
+		}
+		end := start.Add(minDuration)
+		slot := QuorumSlot{Start: start, End: maxEnd}
+		for i, resource := range resources {
+			for _, run := range avail[i] {
+				if !run.Start.After(start) && !run.End.Before(end) {
+					slot.Available = append(slot.Available, resource)
+					slot.End = util.MinTime(slot.End, run.End)
+					break
+				}
+			}
+		}
+		if len(slot.Available) < quorum {
+			continue
+		}
+		if len(slots) > 0 {
+			// skip slots that are part of the previous one
+			prev := slots[len(slots)-1]
+			if start.Before(prev.End) && sameResources(prev.Available, slot.Available) {
+				continue
+			}
+		}
+		slots = append(slots, slot)
+	}
+	return
+}
+
+// sameResources returns true if a and b list the same resources in
+// the same order.
+func sameResources(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// availability returns the set of times between the given start and
+// end times in which the given resource is free or only has
+// intervals at or below the given priority.
+func availability(tx Tx, resource string, minStart, maxEnd time.Time, maxPriority float64) (avail interval.IntervalSet, err error) {
+	defer Return(&err)
+
+	iter, err := tx.FindFwdIterIn(resource, minStart, maxEnd, maxPriority)
+	Ck(err)
+	clipped := ClipIter(iter, minStart, maxEnd)
+	for iv := clipped.Next(); iv != nil; iv = clipped.Next() {
+		avail = append(avail, iv)
+	}
+	return avail.Normalize(), nil
+}
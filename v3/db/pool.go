@@ -0,0 +1,310 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+	"github.com/stevegt/timectl/v3/interval"
+	"github.com/stevegt/timectl/v3/util"
+)
+
+// Pool is a resource with a capacity greater than one, such as a lab
+// with 4 benches or a build farm with 8 slots.  A pool is stored as
+// one resource per unit of capacity, named by Units, so up to
+// Capacity busy intervals on the pool may overlap while each unit
+// keeps the usual one-at-a-time conflict rules.
+type Pool struct {
+	Name     string
+	Capacity int
+}
+
+// Units returns the names of the resources that make up the pool.
+func (p Pool) Units() (units []string) {
+	for i := 0; i < p.Capacity; i++ {
+		units = append(units, fmt.Sprintf("%s/%d", p.Name, i))
+	}
+	return
+}
+
+// AddToPool adds an interval to a unit of the pool and sets the
+// interval's resource to that unit.  A busy interval fits if, at
+// every moment it covers, fewer than Capacity busy intervals on the
+// pool overlap it.  If no single unit has room, AddToPool moves other
+// intervals between units to make room, which changes their
+// resources.  If the interval doesn't fit, it returns a
+// *ConflictError listing the busy intervals on all units that
+// conflict with iv.  On any error, iv is left unchanged.
+func AddToPool(tx Tx, pool Pool, iv *interval.Interval) (err error) {
+	defer Return(&err)
+
+	units := pool.Units()
+	if len(units) == 0 {
+		return fmt.Errorf("pool %q has no capacity", pool.Name)
+	}
+
+	// try each unit in turn
+	var conflicts []*interval.Interval
+	for _, unit := range units {
+		cp := iv.Clone()
+		cp.Resource = unit
+		err = tx.Add(cp)
+		var cerr *ConflictError
+		if errors.As(err, &cerr) {
+			conflicts = append(conflicts, cerr.Conflicts...)
+			continue
+		}
+		Ck(err)
+		iv.Resource = unit
+		return
+	}
+
+	// No unit has room.  Collect the busy intervals that are
+	// connected to iv by a chain of overlaps; they can be moved
+	// between units without affecting any others.
+	start, end := iv.Start, iv.End
+	members := make(map[uint64]*interval.Interval)
+	for grew := true; grew; {
+		grew = false
+		for _, unit := range units {
+			iter, err := tx.FindFwdIterIn(unit, start, end, math.MaxFloat64)
+			Ck(err)
+			for found := iter.Next(); found != nil; found = iter.Next() {
+				if !found.Busy() || found.Id == iv.Id || members[found.Id] != nil {
+					continue
+				}
+				members[found.Id] = found
+				start = util.MinTime(start, found.Start)
+				end = util.MaxTime(end, found.End)
+				grew = true
+			}
+		}
+	}
+	cluster := []*interval.Interval{iv}
+	for _, member := range members {
+		cluster = append(cluster, member)
+	}
+	if peakOverlap(cluster) > pool.Capacity {
+		return &ConflictError{Interval: iv, Conflicts: conflicts}
+	}
+
+	// Assign the cluster to units in order of start time.  When an
+	// interval starts, every unit whose last interval has ended is
+	// free, and at most Capacity-1 others are still busy, so there
+	// is always a free unit.  We keep intervals on their current unit
+	// when we can.
+	sort.Slice(cluster, func(a, b int) bool {
+		if !cluster[a].Start.Equal(cluster[b].Start) {
+			return cluster[a].Start.Before(cluster[b].Start)
+		}
+		return cluster[a].Id < cluster[b].Id
+	})
+	lastEnd := make(map[string]time.Time)
+	assigned := make(map[*interval.Interval]string)
+	for _, member := range cluster {
+		unit := ""
+		for _, u := range units {
+			if lastEnd[u].After(member.Start) {
+				continue
+			}
+			if unit == "" || u == member.Resource {
+				unit = u
+			}
+		}
+		Assert(unit != "", "no free unit for %v", member)
+		assigned[member] = unit
+		lastEnd[unit] = member.End
+	}
+
+	// move the intervals that changed units, deleting them all first
+	// so that they never conflict with each other on the way
+	var moved []*interval.Interval
+	for _, member := range members {
+		if assigned[member] != member.Resource {
+			moved = append(moved, member)
+			err = tx.Delete(member)
+			Ck(err)
+		}
+	}
+	for _, member := range moved {
+		cp := member.Clone()
+		cp.Resource = assigned[member]
+		err = tx.Add(cp)
+		Ck(err)
+	}
+	cp := iv.Clone()
+	cp.Resource = assigned[iv]
+	err = tx.Add(cp)
+	Ck(err)
+	iv.Resource = cp.Resource
+	return
+}
+
+// peakOverlap returns the largest number of busy intervals in ivs
+// that overlap at any moment.
+func peakOverlap(ivs []*interval.Interval) (peak int) {
+	type event struct {
+		t     time.Time
+		delta int
+	}
+	var events []event
+	for _, iv := range ivs {
+		if iv.Busy() {
+			events = append(events, event{iv.Start, 1}, event{iv.End, -1})
+		}
+	}
+	// an interval that ends when another starts doesn't overlap it,
+	// so ends sort before starts at the same time
+	sort.Slice(events, func(a, b int) bool {
+		if !events[a].t.Equal(events[b].t) {
+			return events[a].t.Before(events[b].t)
+		}
+		return events[a].delta < events[b].delta
+	})
+	n := 0
+	for _, e := range events {
+		n += e.delta
+		peak = max(peak, n)
+	}
+	return
+}
+
+// CapacitySegment is a run of time in which a pool has a constant
+// amount of free capacity, as found by FreeCapacity.
+type CapacitySegment struct {
+	Start time.Time
+	End   time.Time
+	// Free is the number of units that are free or only have
+	// intervals at or below the priority searched for.
+	Free int
+}
+
+// FreeCapacity returns the free capacity of the pool between the
+// given start and end times, as a list of segments in ascending order
+// of start time.  Adjacent segments have different free capacity.
+func FreeCapacity(tx Tx, pool Pool, minStart, maxEnd time.Time, maxPriority float64) (segments []CapacitySegment, err error) {
+	defer Return(&err)
+
+	// every unit's availability starts and ends are segment
+	// boundaries
+	avail, err := poolAvailability(tx, pool, minStart, maxEnd, maxPriority)
+	Ck(err)
+	bounds := []time.Time{minStart, maxEnd}
+	for _, runs := range avail {
+		for _, run := range runs {
+			bounds = append(bounds, run.Start, run.End)
+		}
+	}
+	sort.Slice(bounds, func(a, b int) bool { return bounds[a].Before(bounds[b]) })
+
+	for i := 0; i+1 < len(bounds); i++ {
+		start, end := bounds[i], bounds[i+1]
+		if !end.After(start) {
+			continue
+		}
+		free := len(freeUnits(avail, pool.Units(), start, end))
+		if len(segments) > 0 && segments[len(segments)-1].Free == free {
+			segments[len(segments)-1].End = end
+			continue
+		}
+		segments = append(segments, CapacitySegment{Start: start, End: end, Free: free})
+	}
+	return
+}
+
+// PoolSlot is a time slot in a pool, as found by FindPoolSet.
+type PoolSlot struct {
+	Start time.Time
+	End   time.Time
+	// Free is the smallest free capacity of the pool at any moment
+	// in the slot.
+	Free int
+}
+
+// FindPoolSet is the pool version of FindSet.  It finds a time slot
+// of the given duration between the given start and end times in
+// which the pool has at least need units of free capacity, as
+// reported by FreeCapacity, at every moment.  The first parameter
+// indicates whether the slot should be the first or last one found
+// within the given time range.  If there is no such slot, it returns
+// nil.  Since AddToPool moves intervals between units to make room,
+// need intervals can be added to the pool in the slot.
+func FindPoolSet(tx Tx, pool Pool, need int, first bool, minStart, maxEnd time.Time, minDuration time.Duration, maxPriority float64) (slot *PoolSlot, err error) {
+	defer Return(&err)
+
+	if need < 1 {
+		return nil, fmt.Errorf("need must be at least 1, got %d", need)
+	}
+
+	segments, err := FreeCapacity(tx, pool, minStart, maxEnd, maxPriority)
+	Ck(err)
+
+	// group adjacent segments with enough capacity into runs, and
+	// pick the first or last run that is long enough
+	var runs []CapacitySegment
+	for _, seg := range segments {
+		if seg.Free < need {
+			continue
+		}
+		if len(runs) > 0 && runs[len(runs)-1].End.Equal(seg.Start) {
+			runs[len(runs)-1].End = seg.End
+			continue
+		}
+		runs = append(runs, seg)
+	}
+	for i := range runs {
+		run := runs[len(runs)-1-i]
+		if first {
+			run = runs[i]
+		}
+		if run.End.Sub(run.Start) < minDuration {
+			continue
+		}
+		slot = &PoolSlot{Start: run.Start, End: run.Start.Add(minDuration)}
+		if !first {
+			slot = &PoolSlot{Start: run.End.Add(-minDuration), End: run.End}
+		}
+		break
+	}
+	if slot == nil {
+		return nil, nil
+	}
+
+	// the free capacity of the slot is the least of its segments
+	slot.Free = pool.Capacity
+	for _, seg := range segments {
+		if seg.Start.Before(slot.End) && seg.End.After(slot.Start) {
+			slot.Free = min(slot.Free, seg.Free)
+		}
+	}
+	return
+}
+
+// poolAvailability returns the availability of each unit of the
+// pool.
+func poolAvailability(tx Tx, pool Pool, minStart, maxEnd time.Time, maxPriority float64) (avail []interval.IntervalSet, err error) {
+	defer Return(&err)
+	for _, unit := range pool.Units() {
+		runs, err := availability(tx, unit, minStart, maxEnd, maxPriority)
+		Ck(err)
+		avail = append(avail, runs)
+	}
+	return
+}
+
+// freeUnits returns the units whose availability covers the whole
+// time from start to end.
+func freeUnits(avail []interval.IntervalSet, units []string, start, end time.Time) (free []string) {
+	for i, runs := range avail {
+		for _, run := range runs {
+			if !run.Start.After(start) && !run.End.Before(end) {
+				free = append(free, units[i])
+				break
+			}
+		}
+	}
+	return
+}
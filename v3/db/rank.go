@@ -0,0 +1,131 @@
+package db
+
+import (
+	"sort"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+	"github.com/stevegt/timectl/v3/interval"
+	"github.com/stevegt/timectl/v3/util"
+)
+
+// Candidate is a candidate set of intervals found by FindSets.
+type Candidate struct {
+	// Set is a contiguous set of intervals in ascending order of
+	// start time, as returned by FindSet.
+	Set []*interval.Interval
+	// Start and End are the start and end of the set, clipped to the
+	// search range.
+	Start time.Time
+	End   time.Time
+	// Duration is the duration that was searched for.  Work of this
+	// duration can be placed anywhere from Start to End.
+	Duration time.Duration
+	// Score is the score given to the candidate by the ScoreFunc.
+	Score float64
+}
+
+// ScoreFunc scores a candidate set for FindSets.  Lower scores are
+// better.
+type ScoreFunc func(c *Candidate) float64
+
+// PreemptionCost scores a candidate by the sum of the priorities of
+// the busy intervals that would be displaced by using it.
+func PreemptionCost(c *Candidate) (cost float64) {
+	for _, iv := range c.Set {
+		cost += iv.Priority
+	}
+	return
+}
+
+// TightestFit scores a candidate by how much time would be left over
+// in it, in seconds, so that the smallest slot that fits wins.
+func TightestFit(c *Candidate) float64 {
+	return (c.End.Sub(c.Start) - c.Duration).Seconds()
+}
+
+// EarliestEnd scores a candidate by how early work placed at its
+// start would end.
+func EarliestEnd(c *Candidate) float64 {
+	return unixSeconds(c.Start.Add(c.Duration))
+}
+
+// ClosestTo returns a ScoreFunc that scores a candidate by how far,
+// in seconds, the closest start time in the candidate is from the
+// given preferred start time.
+func ClosestTo(t time.Time) ScoreFunc {
+	return func(c *Candidate) float64 {
+		latest := c.End.Add(-c.Duration)
+		switch {
+		case t.Before(c.Start):
+			return c.Start.Sub(t).Seconds()
+		case t.After(latest):
+			return t.Sub(latest).Seconds()
+		}
+		return 0
+	}
+}
+
+// unixSeconds returns t as floating point seconds since the Unix
+// epoch.
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// FindSets enumerates every candidate set of intervals between the
+// given start and end times that FindSet could return -- for each
+// interval, the shortest contiguous set starting with that interval
+// whose total duration within the range is at least minDuration --
+// and returns the n best candidates as ranked by the score function,
+// best first.  Candidates with equal scores are returned in order of
+// start time.  If n is zero or less, all candidates are returned.
+func FindSets(tx Tx, minStart, maxEnd time.Time, minDuration time.Duration, maxPriority float64, score ScoreFunc, n int) (candidates []*Candidate, err error) {
+	defer Return(&err)
+
+	iter, err := tx.FindFwdIter(minStart, maxEnd, maxPriority)
+	Ck(err)
+
+	// split the results into runs of contiguous intervals
+	var runs [][]*interval.Interval
+	var run []*interval.Interval
+	for iv := iter.Next(); iv != nil; iv = iter.Next() {
+		if len(run) > 0 && iv.Start.After(run[len(run)-1].End) {
+			runs = append(runs, run)
+			run = nil
+		}
+		run = append(run, iv)
+	}
+	if len(run) > 0 {
+		runs = append(runs, run)
+	}
+
+	// find the shortest qualifying set starting at each interval
+	for _, run := range runs {
+		for i := range run {
+			var found time.Duration
+			for j := i; j < len(run); j++ {
+				found += run[j].OverlapDuration(minStart, maxEnd)
+				if found < minDuration {
+					continue
+				}
+				c := &Candidate{
+					Set:      run[i : j+1 : j+1],
+					Start:    util.MaxTime(run[i].Start, minStart),
+					End:      util.MinTime(run[j].End, maxEnd),
+					Duration: minDuration,
+				}
+				c.Score = score(c)
+				candidates = append(candidates, c)
+				break
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return candidates[a].Score < candidates[b].Score
+	})
+	if n > 0 && len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	return
+}
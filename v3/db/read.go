@@ -2,19 +2,25 @@ package db
 
 import (
 	"math"
+	"slices"
 	"time"
 
 	. "github.com/stevegt/goadapt"
 	"github.com/stevegt/timectl/v3/interval"
+	"github.com/stevegt/timectl/v3/util"
 )
 
 // FindSet returns a contiguous set of intervals that intersect
 // with the given start and end time, are lower than the given
 // priority, and whose total duration is greater than or equal to the
-// given duration.  The first parameter indicates whether the set
-// should be the first or last match found within the given time
-// range. The results include synthetic free intervals that represent
-// the time slots between the intervals.
+// given duration.  Only the part of each interval that falls within
+// the given time range counts toward the total duration; the
+// intervals themselves are returned unclipped, so use ClipIter if you
+// need them trimmed to the range.  The first parameter indicates
+// whether the set should be the first or last match found within the
+// given time range. The results include synthetic free intervals that
+// represent the time slots between the intervals, including any free
+// time at the start or end of the range.
 func FindSet(tx Tx, first bool, minStart, maxEnd time.Time, minDuration time.Duration, maxPriority float64) (set []*interval.Interval, err error) {
 	defer Return(&err)
 
@@ -57,23 +63,185 @@ func FindSet(tx Tx, first bool, minStart, maxEnd time.Time, minDuration time.Dur
 		if len(set) == 0 {
 			// start a new set
 			set = append(set, iv)
-			foundDuration = iv.Duration()
+			foundDuration = iv.OverlapDuration(minStart, maxEnd)
 			continue
 		}
 		// we have a contiguous interval; add it to the set
 		set = append(set, iv)
-		foundDuration += iv.Duration()
+		foundDuration += iv.OverlapDuration(minStart, maxEnd)
 	}
 
 }
 
+// FindSplitSet is like FindSet, but for work that can be
+// interrupted.  It returns up to maxChunks non-contiguous chunks,
+// each of which is a contiguous set of intervals at least minChunk
+// long, whose total duration is greater than or equal to the given
+// duration.  A maxChunks of zero or less means there is no limit on
+// the number of chunks.  As with FindSet, only time within the given
+// range counts toward chunk durations.  The first parameter indicates
+// whether the chunks should complete as early or as late as possible
+// within the given time range; chunks and the intervals within them
+// are returned in the order they were found.  Like FindSet, the
+// results include synthetic free intervals.
+func FindSplitSet(tx Tx, first bool, minStart, maxEnd time.Time, minDuration time.Duration, maxPriority float64, minChunk time.Duration, maxChunks int) (chunks [][]*interval.Interval, err error) {
+	defer Return(&err)
+
+	var candidates Iterator
+	if first {
+		candidates, err = tx.FindFwdIter(minStart, maxEnd, maxPriority)
+		Ck(err)
+	} else {
+		candidates, err = tx.FindRevIter(minStart, maxEnd, maxPriority)
+		Ck(err)
+	}
+
+	// chunks holds the largest finished runs found so far, in the
+	// order they were found; cur is the run being built
+	var cur []*interval.Interval
+	var curDuration time.Duration
+	for {
+		iv := candidates.Next()
+		if iv == nil {
+			// we didn't find a set that meets the criteria
+			return nil, nil
+		}
+
+		if len(cur) != 0 {
+			// if the previous interval is not contiguous, finish the
+			// current run
+			prevIv := cur[len(cur)-1]
+			if (first && iv.Start.After(prevIv.End)) || (!first && iv.End.Before(prevIv.Start)) {
+				if curDuration >= minChunk {
+					chunks = append(chunks, cur)
+					if maxChunks > 0 && len(chunks) > maxChunks {
+						chunks = dropSmallest(chunks, minStart, maxEnd)
+					}
+				}
+				cur = nil
+				curDuration = 0
+			}
+		}
+		cur = append(cur, iv)
+		curDuration += iv.OverlapDuration(minStart, maxEnd)
+		if curDuration < minChunk {
+			continue
+		}
+
+		// see whether the current run plus the largest finished runs
+		// meet the criteria
+		best := chunks
+		if maxChunks > 0 && len(best) >= maxChunks {
+			best = dropSmallest(best, minStart, maxEnd)
+		}
+		total := curDuration
+		for _, chunk := range best {
+			total += chunkDuration(chunk, minStart, maxEnd)
+		}
+		if total >= minDuration {
+			return append(best, cur), nil
+		}
+	}
+}
+
+// dropSmallest returns a copy of chunks without the chunk with the
+// shortest total duration within the given range.
+func dropSmallest(chunks [][]*interval.Interval, minStart, maxEnd time.Time) (out [][]*interval.Interval) {
+	smallest := 0
+	for i, chunk := range chunks {
+		if chunkDuration(chunk, minStart, maxEnd) < chunkDuration(chunks[smallest], minStart, maxEnd) {
+			smallest = i
+		}
+	}
+	out = append(out, chunks[:smallest]...)
+	return append(out, chunks[smallest+1:]...)
+}
+
+// chunkDuration returns the total duration of the intervals in chunk
+// within the given range.
+func chunkDuration(chunk []*interval.Interval, minStart, maxEnd time.Time) (total time.Duration) {
+	for _, iv := range chunk {
+		total += iv.OverlapDuration(minStart, maxEnd)
+	}
+	return
+}
+
+// ClipIter returns an iterator that clips the intervals returned by
+// the given iterator to the given start and end times.  The clipped
+// intervals are copies that keep the original id, priority, and
+// payload; intervals that fall entirely outside the range are
+// skipped.
+func ClipIter(iter Iterator, minStart, maxEnd time.Time) Iterator {
+	return NewClipIterator(iter, minStart, maxEnd)
+}
+
+// FindFreeIter returns an iterator over the free time between the
+// given start and end times -- the time not covered by any busy
+// interval.  It yields only free intervals, with id 0 and priority 0,
+// never busy intervals.  Stored free intervals don't add free time of
+// their own, so the parts of them under busy intervals are not free.
+// Contiguous free time is merged into a single interval, results are
+// clipped to the given range, and gaps shorter than minGap are
+// skipped.  The first parameter indicates whether to iterate forward
+// or backward in time.
+func FindFreeIter(tx Tx, first bool, minStart, maxEnd time.Time, minGap time.Duration) (iter Iterator, err error) {
+	defer Return(&err)
+
+	found, err := tx.FindFwdIter(minStart, maxEnd, math.MaxFloat64)
+	Ck(err)
+	var busy interval.IntervalSet
+	for iv := found.Next(); iv != nil; iv = found.Next() {
+		if iv.Busy() {
+			busy = append(busy, iv)
+		}
+	}
+
+	var free []*interval.Interval
+	for _, gap := range busy.Complement(minStart, maxEnd) {
+		if gap.Duration() >= minGap {
+			free = append(free, gap)
+		}
+	}
+	if !first {
+		slices.Reverse(free)
+	}
+	return &sliceIterator{ivs: free}, nil
+}
+
+// FindFree returns the free time between the given start and end
+// times as a slice of intervals, in ascending order of start time.
+// See FindFreeIter.
+func FindFree(tx Tx, minStart, maxEnd time.Time, minGap time.Duration) (free []*interval.Interval, err error) {
+	defer Return(&err)
+
+	iter, err := FindFreeIter(tx, true, minStart, maxEnd, minGap)
+	Ck(err)
+	for iv := iter.Next(); iv != nil; iv = iter.Next() {
+		free = append(free, iv)
+	}
+	return
+}
+
 // Conflicts returns true if the given interval conflicts with any
-// existing intervals in the database.
+// existing intervals on the same resource.
 func Conflicts(tx Tx, iv *interval.Interval) (conflicts bool, err error) {
 	defer Return(&err)
 
+	found, err := FindConflicts(tx, iv)
+	Ck(err)
+	return len(found) > 0, nil
+}
+
+// FindConflicts returns the existing busy intervals on the given
+// interval's resource that intersect with the given interval.  A
+// stored interval with the same id as the given interval is not a
+// conflict, because storing the given interval replaces it.  The
+// results are ordered by ascending end time.
+func FindConflicts(tx Tx, iv *interval.Interval) (conflicts []*interval.Interval, err error) {
+	defer Return(&err)
+
 	// find all intervals that intersect with the given interval
-	iter, err := tx.FindFwdIter(iv.Start, iv.End, math.MaxFloat64)
+	iter, err := tx.FindFwdIterIn(iv.Resource, iv.Start, iv.End, math.MaxFloat64)
 	Ck(err)
 
 	// any non-zero priority interval that intersects with the given
@@ -83,10 +251,100 @@ func Conflicts(tx Tx, iv *interval.Interval) (conflicts bool, err error) {
 		if found == nil {
 			break
 		}
-		if found.Priority != 0 {
-			return true, nil
+		if found.Priority != 0 && found.Id != iv.Id {
+			conflicts = append(conflicts, found)
+		}
+	}
+
+	return
+}
+
+// AtIn returns the intervals on the given resource that contain the
+// given time.  Backends use it to implement Tx.At; see there.
+//
+// Busy intervals on a resource don't overlap, so AtIn only scans back
+// to the nearest busy interval that starts on or before the given
+// time.  Stored free intervals may overlap busy ones and each other,
+// though, so it also scans all of the stored free intervals in the
+// database; its cost grows with their number, but not with the number
+// of busy intervals.
+func AtIn(tx Tx, resource string, t time.Time) (ivs []*interval.Interval, err error) {
+	defer Return(&err)
+
+	// the latest busy interval that starts on or before t either
+	// contains t or is the nearest one before it
+	gapStart := util.EarliestTime
+	rev, err := tx.FindRevIterIn(resource, util.EarliestTime, t.Add(1), math.MaxFloat64)
+	Ck(err)
+	for iv := rev.Next(); iv != nil; iv = rev.Next() {
+		if !iv.Busy() {
+			continue
+		}
+		if iv.End.After(t) {
+			ivs = append(ivs, iv)
+		} else {
+			gapStart = iv.End
+		}
+		break
+	}
+
+	// free intervals sort first by priority
+	up, err := tx.IterateUp()
+	Ck(err)
+	for iv := up.Next(); iv != nil && iv.Priority <= 0; iv = up.Next() {
+		if !iv.Busy() && iv.Resource == resource && !iv.Start.After(t) && iv.End.After(t) {
+			ivs = append(ivs, iv)
+		}
+	}
+	if len(ivs) > 0 {
+		return
+	}
+
+	// t is in a gap; the gap ends at the start of the next busy
+	// interval
+	gapEnd := util.LatestTime
+	fwd, err := tx.FindFwdIterIn(resource, t, util.LatestTime, math.MaxFloat64)
+	Ck(err)
+	for iv := fwd.Next(); iv != nil; iv = fwd.Next() {
+		if iv.Busy() {
+			gapEnd = iv.Start
+			break
+		}
+	}
+	Assert(gapStart.Before(gapEnd), "gap %v to %v around %v is empty", gapStart, gapEnd, t)
+	free := &interval.Interval{Start: gapStart, End: gapEnd, Resource: resource}
+	return []*interval.Interval{free}, nil
+}
+
+// NextIn returns the first busy interval on the given resource that
+// starts after the given time.  Backends use it to implement Tx.Next.
+func NextIn(tx Tx, resource string, t time.Time) (next *interval.Interval, err error) {
+	defer Return(&err)
+
+	// busy intervals on a resource don't overlap, so the Find*
+	// order by end time is also the order by start time
+	iter, err := tx.FindFwdIterIn(resource, t, util.LatestTime, math.MaxFloat64)
+	Ck(err)
+	for iv := iter.Next(); iv != nil; iv = iter.Next() {
+		if iv.Busy() && iv.Start.After(t) {
+			return iv, nil
 		}
 	}
+	return nil, nil
+}
 
-	return false, nil
+// PrevIn returns the last busy interval on the given resource that
+// ends on or before the given time.  Backends use it to implement
+// Tx.Prev.
+func PrevIn(tx Tx, resource string, t time.Time) (prev *interval.Interval, err error) {
+	defer Return(&err)
+
+	iter, err := tx.FindRevIterIn(resource, util.EarliestTime, t, math.MaxFloat64)
+	Ck(err)
+	for iv := iter.Next(); iv != nil; iv = iter.Next() {
+		if iv.Busy() && !iv.End.After(t) {
+			return iv, nil
+		}
+	}
+	return nil, nil
 }
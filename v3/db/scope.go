@@ -0,0 +1,159 @@
+package db
+
+import (
+	"time"
+
+	. "github.com/stevegt/goadapt"
+	"github.com/stevegt/timectl/v3/interval"
+)
+
+// Scope returns a transaction that works on the intervals of a
+// single resource.  Intervals added or updated through it are put on
+// the resource, its Find* methods search the resource, and its
+// Iterate* methods only return intervals on the resource, so the
+// db-level helpers such as FindSet, Conflicts, and Preempt can be
+// scoped by passing them the returned transaction.  In a scoped
+// transaction, the default resource is the scope's resource.
+// Methods that take an id work on any interval in the database.
+func Scope(tx Tx, resource string) Tx {
+	return &scopedTx{Tx: tx, resource: resource}
+}
+
+// scopedTx is the transaction returned by Scope.
+type scopedTx struct {
+	Tx
+	resource string
+}
+
+// Add adds a copy of iv, put on the scope's resource, to the
+// database.  iv itself is not changed.
+func (tx *scopedTx) Add(iv *interval.Interval) error {
+	return tx.Tx.Add(tx.onResource(iv))
+}
+
+// Update updates the database with a copy of iv, put on the scope's
+// resource.  iv itself is not changed.
+func (tx *scopedTx) Update(iv *interval.Interval) error {
+	return tx.Tx.Update(tx.onResource(iv))
+}
+
+// onResource returns a copy of iv on the scope's resource.
+func (tx *scopedTx) onResource(iv *interval.Interval) *interval.Interval {
+	cp := iv.Clone()
+	cp.Resource = tx.resource
+	return cp
+}
+
+// FindFwd returns the results of FindFwdIter as a slice.
+func (tx *scopedTx) FindFwd(minStart, maxEnd time.Time, maxPriority float64) (ivs []*interval.Interval, err error) {
+	defer Return(&err)
+	iter, err := tx.FindFwdIter(minStart, maxEnd, maxPriority)
+	Ck(err)
+	for iv := iter.Next(); iv != nil; iv = iter.Next() {
+		ivs = append(ivs, iv)
+	}
+	return
+}
+
+// FindFwdIter searches the scope's resource.
+func (tx *scopedTx) FindFwdIter(minStart, maxEnd time.Time, maxPriority float64) (Iterator, error) {
+	return tx.Tx.FindFwdIterIn(tx.resource, minStart, maxEnd, maxPriority)
+}
+
+// FindRev returns the results of FindRevIter as a slice.
+func (tx *scopedTx) FindRev(minStart, maxEnd time.Time, maxPriority float64) (ivs []*interval.Interval, err error) {
+	defer Return(&err)
+	iter, err := tx.FindRevIter(minStart, maxEnd, maxPriority)
+	Ck(err)
+	for iv := iter.Next(); iv != nil; iv = iter.Next() {
+		ivs = append(ivs, iv)
+	}
+	return
+}
+
+// FindRevIter searches the scope's resource.
+func (tx *scopedTx) FindRevIter(minStart, maxEnd time.Time, maxPriority float64) (Iterator, error) {
+	return tx.Tx.FindRevIterIn(tx.resource, minStart, maxEnd, maxPriority)
+}
+
+// FindFwdIterIn searches the given resource, or the scope's resource
+// if the given resource is the default.
+func (tx *scopedTx) FindFwdIterIn(resource string, minStart, maxEnd time.Time, maxPriority float64) (Iterator, error) {
+	if resource == "" {
+		resource = tx.resource
+	}
+	return tx.Tx.FindFwdIterIn(resource, minStart, maxEnd, maxPriority)
+}
+
+// FindRevIterIn searches the given resource, or the scope's resource
+// if the given resource is the default.
+func (tx *scopedTx) FindRevIterIn(resource string, minStart, maxEnd time.Time, maxPriority float64) (Iterator, error) {
+	if resource == "" {
+		resource = tx.resource
+	}
+	return tx.Tx.FindRevIterIn(resource, minStart, maxEnd, maxPriority)
+}
+
+// At returns the intervals on the scope's resource that contain the
+// given time.
+func (tx *scopedTx) At(t time.Time) ([]*interval.Interval, error) {
+	return AtIn(tx.Tx, tx.resource, t)
+}
+
+// Next returns the first busy interval on the scope's resource that
+// starts after the given time.
+func (tx *scopedTx) Next(t time.Time) (*interval.Interval, error) {
+	return NextIn(tx.Tx, tx.resource, t)
+}
+
+// Prev returns the last busy interval on the scope's resource that
+// ends on or before the given time.
+func (tx *scopedTx) Prev(t time.Time) (*interval.Interval, error) {
+	return PrevIn(tx.Tx, tx.resource, t)
+}
+
+// IterateDown only returns intervals on the scope's resource.
+func (tx *scopedTx) IterateDown() (Iterator, error) {
+	return tx.filter(tx.Tx.IterateDown())
+}
+
+// IterateUp only returns intervals on the scope's resource.
+func (tx *scopedTx) IterateUp() (Iterator, error) {
+	return tx.filter(tx.Tx.IterateUp())
+}
+
+// IterateForward only returns intervals on the scope's resource.
+func (tx *scopedTx) IterateForward() (Iterator, error) {
+	return tx.filter(tx.Tx.IterateForward())
+}
+
+// IterateBackward only returns intervals on the scope's resource.
+func (tx *scopedTx) IterateBackward() (Iterator, error) {
+	return tx.filter(tx.Tx.IterateBackward())
+}
+
+// filter wraps the results of an Iterate* method so that they only
+// include intervals on the scope's resource.
+func (tx *scopedTx) filter(iter Iterator, err error) (Iterator, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &resourceIterator{iter: iter, resource: tx.resource}, nil
+}
+
+// resourceIterator skips the intervals returned by an underlying
+// iterator that are not on a given resource.
+type resourceIterator struct {
+	iter     Iterator
+	resource string
+}
+
+// Next returns the next interval on the resource.
+func (iter *resourceIterator) Next() *interval.Interval {
+	for {
+		iv := iter.iter.Next()
+		if iv == nil || iv.Resource == iter.resource {
+			return iv
+		}
+	}
+}
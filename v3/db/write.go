@@ -1,10 +1,15 @@
 package db
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
 	"time"
 
 	. "github.com/stevegt/goadapt"
 	"github.com/stevegt/timectl/v3/interval"
+	"github.com/stevegt/timectl/v3/util"
 )
 
 // AddStr adds an interval to the database given strings for the start
@@ -20,3 +25,171 @@ func AddStr(tx Tx, id uint64, startStr, endStr string, priority float64) (err er
 	iv := interval.NewInterval(id, start, end, priority)
 	return tx.Add(iv)
 }
+
+// Preempt adds a busy interval to the database, displacing any
+// lower-priority busy intervals that it overlaps.  If trim is false,
+// each displaced interval is deleted.  If trim is true, a displaced
+// interval that sticks out on only one side of iv is trimmed to the
+// part outside iv instead; displaced intervals that iv covers
+// completely, or that stick out on both sides of iv, are deleted.
+//
+// Preempt returns the displaced intervals so the caller can
+// reschedule them.  For a trimmed interval, the returned interval is
+// the part that was cut off; it has the same id as the trimmed
+// interval that remains in the database.  If iv overlaps any busy
+// interval with a priority at or above its own, Preempt returns a
+// *ConflictError listing those intervals and changes nothing.
+func Preempt(tx Tx, iv *interval.Interval, trim bool) (displaced []*interval.Interval, err error) {
+	defer Return(&err)
+
+	conflicts, err := FindConflicts(tx, iv)
+	Ck(err)
+
+	// make sure we can displace everything before changing anything
+	var blockers []*interval.Interval
+	for _, found := range conflicts {
+		if found.Priority >= iv.Priority {
+			blockers = append(blockers, found)
+		}
+	}
+	if len(blockers) > 0 {
+		return nil, &ConflictError{Interval: iv, Conflicts: blockers}
+	}
+
+	for _, victim := range conflicts {
+		cut := *victim
+		switch {
+		case trim && victim.Start.Before(iv.Start) && !victim.End.After(iv.End):
+			// keep the part before iv
+			err = tx.Move(victim.Id, victim.Start, iv.Start)
+			cut.Start = iv.Start
+		case trim && victim.End.After(iv.End) && !victim.Start.Before(iv.Start):
+			// keep the part after iv
+			err = tx.Move(victim.Id, iv.End, victim.End)
+			cut.End = iv.End
+		default:
+			err = tx.Delete(victim)
+		}
+		Ck(err)
+		displaced = append(displaced, &cut)
+	}
+
+	err = tx.Add(iv)
+	Ck(err)
+	return
+}
+
+// ReschedulePolicy controls where Reschedule may place intervals.
+type ReschedulePolicy struct {
+	// Deadline is the latest time a rescheduled interval may end.
+	Deadline time.Time
+	// MaxPriority is the highest priority of existing busy intervals
+	// that a rescheduled interval may displace.  A rescheduled
+	// interval never displaces an interval with a priority at or
+	// above its own.  Zero means that rescheduled intervals are only
+	// placed in free time.
+	MaxPriority float64
+}
+
+// Reschedule finds new places for intervals that were displaced or
+// cancelled.  Each interval is placed at the earliest time on or
+// after the given time where it fits before the policy deadline,
+// keeping its duration, id, priority, payload, and resource.  If an
+// interval with the same id is still in the database, it is moved
+// rather than duplicated.  Each id may appear only once in ivs.
+//
+// Intervals are placed in the order given.  Any intervals displaced
+// to make room are rescheduled in turn after the given ones.
+// Reschedule returns the intervals it placed, at their final times,
+// and the intervals it could not place before the deadline.  Each id
+// appears at most once in the results.
+func Reschedule(tx Tx, ivs []*interval.Interval, after time.Time, policy ReschedulePolicy) (placed, unplaced []*interval.Interval, err error) {
+	defer Return(&err)
+
+	seen := make(map[uint64]bool)
+	for _, iv := range ivs {
+		if seen[iv.Id] {
+			return nil, nil, fmt.Errorf("interval %d is given more than once", iv.Id)
+		}
+		seen[iv.Id] = true
+	}
+
+	queue := append([]*interval.Interval{}, ivs...)
+	for len(queue) > 0 {
+		iv := queue[0]
+		queue = queue[1:]
+
+		// an interval that is still stored must not block its own
+		// new placement
+		stored, err := tx.Get(iv.Id)
+		if errors.Is(err, ErrNotFound) {
+			stored = nil
+		} else {
+			Ck(err)
+			err = tx.Delete(stored)
+			Ck(err)
+		}
+
+		// only displace intervals below the interval's own priority
+		maxPriority := policy.MaxPriority
+		if maxPriority >= iv.Priority {
+			maxPriority = math.Nextafter(iv.Priority, math.Inf(-1))
+		}
+
+		start, ok, err := findSlot(tx, iv.Resource, after, policy.Deadline, iv.Duration(), maxPriority)
+		Ck(err)
+		if !ok {
+			if stored != nil {
+				// leave it where it was
+				err = tx.Add(stored)
+				Ck(err)
+			}
+			unplaced = append(unplaced, iv)
+			continue
+		}
+
+		moved := *iv
+		moved.Start = start
+		moved.End = start.Add(iv.Duration())
+		displaced, err := Preempt(tx, &moved, false)
+		Ck(err)
+		placed = append(placed, &moved)
+		queue = append(queue, displaced...)
+
+		// a displaced interval that we placed earlier is no longer
+		// where we put it
+		for _, victim := range displaced {
+			placed = slices.DeleteFunc(placed, func(p *interval.Interval) bool {
+				return p.Id == victim.Id
+			})
+		}
+	}
+	return
+}
+
+// findSlot returns the earliest start time on or after minStart of a
+// contiguous run of free time and busy intervals at or below
+// maxPriority on the given resource that is at least the given
+// duration long and ends on or before maxEnd.
+func findSlot(tx Tx, resource string, minStart, maxEnd time.Time, duration time.Duration, maxPriority float64) (start time.Time, ok bool, err error) {
+	defer Return(&err)
+
+	iter, err := tx.FindFwdIterIn(resource, minStart, maxEnd, maxPriority)
+	Ck(err)
+	var runEnd time.Time
+	inRun := false
+	for iv := iter.Next(); iv != nil; iv = iter.Next() {
+		ivStart := util.MaxTime(iv.Start, minStart)
+		ivEnd := util.MinTime(iv.End, maxEnd)
+		if !inRun || ivStart.After(runEnd) {
+			// start a new run
+			start = ivStart
+			inRun = true
+		}
+		runEnd = util.MaxTime(runEnd, ivEnd)
+		if runEnd.Sub(start) >= duration {
+			return start, true, nil
+		}
+	}
+	return time.Time{}, false, nil
+}
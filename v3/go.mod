@@ -6,9 +6,11 @@ require (
 	github.com/davecgh/go-spew v1.1.1
 	github.com/hashicorp/go-memdb v1.3.4
 	github.com/stevegt/goadapt v0.7.0
+	go.etcd.io/bbolt v1.3.10
 )
 
 require (
 	github.com/hashicorp/go-immutable-radix v1.3.0 // indirect
 	github.com/hashicorp/golang-lru v0.5.4 // indirect
+	golang.org/x/sys v0.4.0 // indirect
 )
@@ -20,6 +20,10 @@ type Interval struct {
 	Priority float64
 	// Payload is the content or event associated with the interval.
 	Payload any
+	// Resource is the person, room, or calendar that the interval
+	// belongs to.  Intervals only conflict with other intervals on
+	// the same resource.  The empty string is the default resource.
+	Resource string
 }
 
 // NewInterval creates and returns a new Interval with the specified start and end times.
@@ -62,7 +66,11 @@ func (i *Interval) String() string {
 // parameter is true, then a conflict is also detected if either interval
 // is free (priority 0).  If the includeFree parameter is false, then
 // a conflict is only detected if both intervals are busy (priority > 0).
+// Intervals on different resources never conflict.
 func (i *Interval) Conflicts(other *Interval, includeFree bool) bool {
+	if i.Resource != other.Resource {
+		return false
+	}
 	if !includeFree {
 		if i.Priority == 0 || other.Priority == 0 {
 			return false
@@ -77,23 +85,21 @@ func (i *Interval) Conflicts(other *Interval, includeFree bool) bool {
 	return false
 }
 
+// DefaultTolerance is the tolerance used by Equal.  Times that differ
+// by no more than the tolerance are treated as the same time.
+const DefaultTolerance = time.Second
+
 // Equal checks if the current interval is equal to the given interval.
-// Two intervals are equal if their start and end times are the same.
+// Two intervals are equal if their start and end times are the same,
+// within DefaultTolerance.
 func (i *Interval) Equal(other *Interval) bool {
-	// this is too strict
-	// return i.Start.Equal(other.Start) && i.End.Equal(other.End)
-	// XXX tolerance should be an argument
-	tolerance := time.Second
-	startDiff := i.Start.Sub(other.Start)
-	endDiff := i.End.Sub(other.End)
-
-	if startDiff < -tolerance || startDiff > tolerance {
-		return false
-	}
-	if endDiff < -tolerance || endDiff > tolerance {
-		return false
-	}
-	return true
+	// exact comparison is too strict
+	return i.EqualWithin(other, DefaultTolerance)
+}
+
+// EqualWithin is the same as Equal, but it uses the given tolerance.
+func (i *Interval) EqualWithin(other *Interval, tolerance time.Duration) bool {
+	return sameTime(i.Start, other.Start, tolerance) && sameTime(i.End, other.End, tolerance)
 }
 
 // Wraps returns true if the current interval completely contains the
@@ -124,46 +130,51 @@ func (i *Interval) Busy() bool {
 	return true
 }
 
-/*
 // Punch creates one to three new intervals by punching a hole in the
 // current interval.  The current interval must not be busy and must
 // completely contain the hole interval.  The hole interval must be
-// busy. Punch does not modify the current interval.
-func (i *IntervalBase) Punch(hole Interval) (intervals []Interval) {
+// busy.  The results are the free time before the hole, if any, the
+// hole itself, and the free time after the hole, if any; the free
+// intervals have id 0 and the current interval's resource.  Punch
+// does not modify the current interval.  If the conditions are not
+// met, Punch returns nil.
+func (i *Interval) Punch(hole *Interval) (intervals []*Interval) {
 	if i.Busy() || !i.Wraps(hole) || !hole.Busy() {
 		return nil
 	}
 	if i.Start.Before(hole.Start) {
-		intervals = append(intervals, NewInterval(i.Start, hole.Start, 0))
+		before := NewInterval(0, i.Start, hole.Start, 0)
+		before.Resource = i.Resource
+		intervals = append(intervals, before)
 	}
 	intervals = append(intervals, hole)
 	if hole.End.Before(i.End) {
-		intervals = append(intervals, NewInterval(hole.End, i.End, 0))
+		after := NewInterval(0, hole.End, i.End, 0)
+		after.Resource = i.Resource
+		intervals = append(intervals, after)
 	}
 	return intervals
 }
-*/
 
-/*
 // Intersection returns an interval that is the intersection of two
 // intervals.  The intersection is the interval that overlaps both
-// intervals.
-func (i *IntervalBase) Intersection(other Interval) Interval {
+// intervals; it has id 0 and priority 0.  If the intervals do not
+// overlap, Intersection returns nil.
+func (i *Interval) Intersection(other *Interval) *Interval {
 	start := util.MaxTime(i.Start, other.Start)
 	end := util.MinTime(i.End, other.End)
 	if start.Before(end) {
-		return NewInterval(start, end, 0)
+		return NewInterval(0, start, end, 0)
 	}
 	return nil
 }
-*/
 
-/*
-// Clone returns a deep copy of the interval.
-func (i *IntervalBase) Clone() Interval {
-	return NewInterval(i.Start, i.End, i.Priority)
+// Clone returns a copy of the interval.  The payload is shared with
+// the current interval, not copied.
+func (i *Interval) Clone() *Interval {
+	cp := *i
+	return &cp
 }
-*/
 
 // Overlaps returns true if the current interval intersects with the given interval.
 func (i *Interval) Overlaps(other *Interval) bool {
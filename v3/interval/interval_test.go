@@ -159,7 +159,6 @@ func TestWraps(t *testing.T) {
 	Tassert(t, !interval4.Wraps(interval1), "expected interval4 to not wrap interval1")
 }
 
-/*
 // Intersection returns an interval that is the intersection of two
 // intervals.  The intersection is the interval that overlaps both
 // intervals.
@@ -173,6 +172,7 @@ func TestIntersection(t *testing.T) {
 	t1130, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T11:30:00")
 	Ck(err)
 	t1200, err := time.Parse("2006-01-02T15:04:05", "2024-01-01T12:00:00")
+	Ck(err)
 
 	i1000_1100 := NewInterval(1, t1000, t1100, 1)
 	i1030_1130 := NewInterval(2, t1030, t1130, 1)
@@ -183,6 +183,4 @@ func TestIntersection(t *testing.T) {
 	i1130_1200 := NewInterval(3, t1130, t1200, 1)
 	iNil := i1000_1100.Intersection(i1130_1200)
 	Tassert(t, iNil == nil, "expected nil, got %v", iNil)
-
 }
-*/
@@ -0,0 +1,133 @@
+package interval
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/stevegt/timectl/v3/util"
+)
+
+// Relation is one of the 13 relations of Allen's interval algebra.
+// Exactly one relation holds between any two intervals.  The
+// constants are ordered so that each relation's inverse is at the
+// mirror position; see Inverse.
+type Relation int
+
+const (
+	// Before means the interval ends before the other starts.
+	Before Relation = iota
+	// Meets means the interval ends when the other starts.
+	Meets
+	// Overlaps means the interval starts first and ends during the
+	// other.
+	Overlaps
+	// Starts means the intervals start together and the interval
+	// ends first.
+	Starts
+	// During means the interval starts after and ends before the
+	// other.
+	During
+	// Finishes means the intervals end together and the interval
+	// starts last.
+	Finishes
+	// Equals means the intervals start and end together.
+	Equals
+	// FinishedBy is the inverse of Finishes.
+	FinishedBy
+	// Contains is the inverse of During.
+	Contains
+	// StartedBy is the inverse of Starts.
+	StartedBy
+	// OverlappedBy is the inverse of Overlaps.
+	OverlappedBy
+	// MetBy is the inverse of Meets.
+	MetBy
+	// After is the inverse of Before.
+	After
+)
+
+var relationNames = []string{
+	"before",
+	"meets",
+	"overlaps",
+	"starts",
+	"during",
+	"finishes",
+	"equals",
+	"finished by",
+	"contains",
+	"started by",
+	"overlapped by",
+	"met by",
+	"after",
+}
+
+// String returns the name of the relation.
+func (r Relation) String() string {
+	if r < Before || r > After {
+		return fmt.Sprintf("Relation(%d)", int(r))
+	}
+	return relationNames[r]
+}
+
+// Inverse returns the relation that holds with the intervals swapped:
+// if a.Relation(b) is r, then b.Relation(a) is r.Inverse().
+func (r Relation) Inverse() Relation {
+	return After - r
+}
+
+// Relation returns the Allen relation of the current interval to the
+// given interval.  Times that differ by no more than the given
+// tolerance are treated as the same time; pass DefaultTolerance to
+// match Equal, or zero for exact comparison.
+func (i *Interval) Relation(other *Interval, tolerance time.Duration) Relation {
+	startCmp := compareTimes(i.Start, other.Start, tolerance)
+	endCmp := compareTimes(i.End, other.End, tolerance)
+	switch {
+	case startCmp == 0 && endCmp == 0:
+		return Equals
+	// shared start or end times take precedence over meeting, which
+	// an interval shorter than the tolerance would also satisfy
+	case startCmp == 0 && endCmp < 0:
+		return Starts
+	case startCmp == 0:
+		return StartedBy
+	case endCmp == 0 && startCmp > 0:
+		return Finishes
+	case endCmp == 0:
+		return FinishedBy
+	case sameTime(i.End, other.Start, tolerance):
+		return Meets
+	case sameTime(i.Start, other.End, tolerance):
+		return MetBy
+	case i.End.Before(other.Start):
+		return Before
+	case i.Start.After(other.End):
+		return After
+	case startCmp < 0 && endCmp < 0:
+		return Overlaps
+	case startCmp < 0:
+		return Contains
+	case endCmp > 0:
+		return OverlappedBy
+	}
+	return During
+}
+
+// sameTime returns true if a and b differ by no more than the
+// tolerance.
+func sameTime(a, b time.Time, tolerance time.Duration) bool {
+	return util.AbsDuration(a.Sub(b)) <= tolerance
+}
+
+// compareTimes returns 0 if a and b are the same time within the
+// tolerance, -1 if a is earlier, and 1 if a is later.
+func compareTimes(a, b time.Time, tolerance time.Duration) int {
+	switch {
+	case sameTime(a, b, tolerance):
+		return 0
+	case a.Before(b):
+		return -1
+	}
+	return 1
+}
@@ -0,0 +1,65 @@
+package interval
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestRelation(t *testing.T) {
+	base := NewInterval(1, hm("10:00"), hm("12:00"), 1)
+	cases := []struct {
+		start, end string
+		expect     Relation
+	}{
+		{"08:00", "09:00", Before},
+		{"09:00", "10:00", Meets},
+		{"09:00", "11:00", Overlaps},
+		{"10:00", "11:00", Starts},
+		{"10:30", "11:30", During},
+		{"11:00", "12:00", Finishes},
+		{"10:00", "12:00", Equals},
+		{"09:00", "12:00", FinishedBy},
+		{"09:00", "13:00", Contains},
+		{"10:00", "13:00", StartedBy},
+		{"11:00", "13:00", OverlappedBy},
+		{"12:00", "13:00", MetBy},
+		{"13:00", "14:00", After},
+	}
+	for _, c := range cases {
+		iv := NewInterval(2, hm(c.start), hm(c.end), 1)
+		got := iv.Relation(base, 0)
+		Tassert(t, got == c.expect, "%s-%s: expected %v, got %v", c.start, c.end, c.expect, got)
+		got = base.Relation(iv, 0)
+		Tassert(t, got == c.expect.Inverse(), "%s-%s: expected inverse %v, got %v", c.start, c.end, c.expect.Inverse(), got)
+	}
+	Tassert(t, Before.String() == "before" && OverlappedBy.String() == "overlapped by", "unexpected names %q and %q", Before, OverlappedBy)
+	Tassert(t, Relation(99).String() == "Relation(99)", "unexpected name %q", Relation(99))
+}
+
+func TestRelationTolerance(t *testing.T) {
+	base := NewInterval(1, hm("10:00"), hm("12:00"), 1)
+
+	// half a second late is the same time by default, but not exactly
+	iv := NewInterval(2, hm("10:00").Add(500*time.Millisecond), hm("12:00"), 1)
+	Tassert(t, iv.Relation(base, DefaultTolerance) == Equals, "expected equals, got %v", iv.Relation(base, DefaultTolerance))
+	Tassert(t, iv.Relation(base, 0) == Finishes, "expected finishes, got %v", iv.Relation(base, 0))
+	Tassert(t, iv.Equal(base), "expected Equal to use the default tolerance")
+	Tassert(t, !iv.EqualWithin(base, 0), "expected EqualWithin to use the given tolerance")
+
+	// a five minute gap meets with a ten minute tolerance
+	iv = NewInterval(2, hm("12:05"), hm("13:00"), 1)
+	Tassert(t, iv.Relation(base, 10*time.Minute) == MetBy, "expected met by, got %v", iv.Relation(base, 10*time.Minute))
+	Tassert(t, iv.Relation(base, 0) == After, "expected after, got %v", iv.Relation(base, 0))
+
+	// an interval shorter than the tolerance that shares a start
+	// time starts the other, rather than being met by it
+	long := NewInterval(1, hm("09:00"), hm("10:00"), 1)
+	short := NewInterval(2, hm("09:00"), hm("09:00").Add(500*time.Millisecond), 1)
+	Tassert(t, long.Relation(short, DefaultTolerance) == StartedBy, "expected started by, got %v", long.Relation(short, DefaultTolerance))
+	Tassert(t, short.Relation(long, DefaultTolerance) == Starts, "expected starts, got %v", short.Relation(long, DefaultTolerance))
+	short = NewInterval(2, hm("10:00").Add(-500*time.Millisecond), hm("10:00"), 1)
+	Tassert(t, long.Relation(short, DefaultTolerance) == FinishedBy, "expected finished by, got %v", long.Relation(short, DefaultTolerance))
+	Tassert(t, short.Relation(long, DefaultTolerance) == Finishes, "expected finishes, got %v", short.Relation(long, DefaultTolerance))
+}
@@ -0,0 +1,122 @@
+package interval
+
+import (
+	"sort"
+	"time"
+
+	"github.com/stevegt/timectl/v3/util"
+)
+
+// IntervalSet is a set of points in time, represented as a list of
+// intervals.  The set operations treat the intervals as plain time
+// ranges:  their results are new intervals with id 0 and priority 0,
+// and the ids, priorities, payloads, and resources of the operands
+// are ignored.
+//
+// The set operations accept any list of intervals and return
+// normalized sets.  A normalized set is sorted by start time and has
+// no intervals that are empty, overlap, or touch.
+type IntervalSet []*Interval
+
+// NewIntervalSet returns the normalized set of the given intervals.
+func NewIntervalSet(ivs ...*Interval) IntervalSet {
+	return IntervalSet(ivs).Normalize()
+}
+
+// Normalize returns the set as a list of intervals sorted by start
+// time, with empty intervals dropped and overlapping or adjacent
+// intervals merged.
+func (s IntervalSet) Normalize() (out IntervalSet) {
+	sorted := make(IntervalSet, 0, len(s))
+	for _, iv := range s {
+		if iv != nil && iv.End.After(iv.Start) {
+			sorted = append(sorted, iv)
+		}
+	}
+	sort.Slice(sorted, func(a, b int) bool {
+		return sorted[a].Start.Before(sorted[b].Start)
+	})
+	for _, iv := range sorted {
+		if len(out) > 0 && !iv.Start.After(out[len(out)-1].End) {
+			last := out[len(out)-1]
+			last.End = util.MaxTime(last.End, iv.End)
+			continue
+		}
+		out = append(out, NewInterval(0, iv.Start, iv.End, 0))
+	}
+	return
+}
+
+// Duration returns the total duration of the set.
+func (s IntervalSet) Duration() (total time.Duration) {
+	for _, iv := range s.Normalize() {
+		total += iv.Duration()
+	}
+	return
+}
+
+// Union returns the points in time that are in either set.
+func (s IntervalSet) Union(other IntervalSet) IntervalSet {
+	all := make(IntervalSet, 0, len(s)+len(other))
+	all = append(all, s...)
+	all = append(all, other...)
+	return all.Normalize()
+}
+
+// Intersection returns the points in time that are in both sets.
+func (s IntervalSet) Intersection(other IntervalSet) (out IntervalSet) {
+	a := s.Normalize()
+	b := other.Normalize()
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		if iv := a[i].Intersection(b[j]); iv != nil {
+			out = append(out, iv)
+		}
+		// advance whichever interval ends first
+		if a[i].End.Before(b[j].End) {
+			i++
+		} else {
+			j++
+		}
+	}
+	return
+}
+
+// Difference returns the points in time that are in the set but not
+// in the other set.
+func (s IntervalSet) Difference(other IntervalSet) (out IntervalSet) {
+	b := other.Normalize()
+	for _, iv := range s.Normalize() {
+		start := iv.Start
+		for _, hole := range b {
+			if !hole.End.After(start) {
+				continue
+			}
+			if !hole.Start.Before(iv.End) {
+				break
+			}
+			if hole.Start.After(start) {
+				out = append(out, NewInterval(0, start, hole.Start, 0))
+			}
+			start = util.MaxTime(start, hole.End)
+		}
+		if iv.End.After(start) {
+			out = append(out, NewInterval(0, start, iv.End, 0))
+		}
+	}
+	return
+}
+
+// Complement returns the points in time between start and end that
+// are not in the set.
+func (s IntervalSet) Complement(start, end time.Time) IntervalSet {
+	window := NewInterval(0, start, end, 0)
+	if window == nil {
+		return nil
+	}
+	return IntervalSet{window}.Difference(s)
+}
+
+// Punch returns the set with the time covered by the hole removed.
+func (s IntervalSet) Punch(hole *Interval) IntervalSet {
+	return s.Difference(IntervalSet{hole})
+}
@@ -0,0 +1,109 @@
+package interval
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+// set builds an IntervalSet from pairs of "15:04" times on
+// 2024-01-01, without normalizing it.
+func set(times ...string) (s IntervalSet) {
+	for i := 0; i < len(times); i += 2 {
+		s = append(s, NewInterval(0, hm(times[i]), hm(times[i+1]), 1))
+	}
+	return
+}
+
+func hm(str string) time.Time {
+	t, err := time.Parse("2006-01-02T15:04", "2024-01-01T"+str)
+	Ck(err)
+	return t
+}
+
+func checkSet(t *testing.T, name string, got IntervalSet, times ...string) {
+	t.Helper()
+	expect := set(times...)
+	Tassert(t, len(got) == len(expect), "%s: expected %v, got %v", name, expect, got)
+	for i := range expect {
+		Tassert(t, got[i].Start.Equal(expect[i].Start) && got[i].End.Equal(expect[i].End), "%s: expected %v, got %v", name, expect, got)
+		Tassert(t, got[i].Id == 0 && got[i].Priority == 0, "%s: expected id 0 and priority 0, got %v", name, got[i])
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	// out of order, overlapping, and adjacent intervals are merged
+	s := set("11:00", "12:00", "09:00", "10:00", "09:30", "10:30", "10:30", "10:45", "13:00", "14:00")
+	checkSet(t, "Normalize", s.Normalize(), "09:00", "10:45", "11:00", "12:00", "13:00", "14:00")
+	// the original is unchanged
+	Tassert(t, s[1].End.Equal(hm("10:00")), "Normalize changed its input: %v", s)
+	checkSet(t, "NewIntervalSet", NewIntervalSet(s...), "09:00", "10:45", "11:00", "12:00", "13:00", "14:00")
+	Tassert(t, s.Duration() == 3*time.Hour+45*time.Minute, "expected 3h45m, got %v", s.Duration())
+	checkSet(t, "empty", IntervalSet{}.Normalize())
+}
+
+func TestUnion(t *testing.T) {
+	a := set("09:00", "10:00", "12:00", "13:00")
+	b := set("09:30", "11:00", "13:00", "14:00", "15:00", "16:00")
+	checkSet(t, "Union", a.Union(b), "09:00", "11:00", "12:00", "14:00", "15:00", "16:00")
+	checkSet(t, "Union empty", a.Union(nil), "09:00", "10:00", "12:00", "13:00")
+}
+
+func TestSetIntersection(t *testing.T) {
+	a := set("09:00", "11:00", "12:00", "15:00")
+	b := set("10:00", "12:30", "13:00", "14:00", "14:30", "16:00")
+	checkSet(t, "Intersection", a.Intersection(b), "10:00", "11:00", "12:00", "12:30", "13:00", "14:00", "14:30", "15:00")
+	checkSet(t, "Intersection empty", a.Intersection(nil))
+	checkSet(t, "Intersection disjoint", set("09:00", "10:00").Intersection(set("10:00", "11:00")))
+}
+
+func TestDifference(t *testing.T) {
+	a := set("09:00", "12:00", "13:00", "15:00")
+	b := set("08:00", "09:30", "10:00", "10:30", "11:30", "13:30", "14:00", "14:15")
+	checkSet(t, "Difference", a.Difference(b), "09:30", "10:00", "10:30", "11:30", "13:30", "14:00", "14:15", "15:00")
+	checkSet(t, "Difference everything", a.Difference(set("08:00", "16:00")))
+	checkSet(t, "Difference nothing", a.Difference(nil), "09:00", "12:00", "13:00", "15:00")
+}
+
+func TestComplement(t *testing.T) {
+	busy := set("09:00", "10:00", "11:00", "12:00", "16:00", "18:00")
+	checkSet(t, "Complement", busy.Complement(hm("08:00"), hm("17:00")), "08:00", "09:00", "10:00", "11:00", "12:00", "16:00")
+	checkSet(t, "Complement empty set", IntervalSet{}.Complement(hm("08:00"), hm("17:00")), "08:00", "17:00")
+	checkSet(t, "Complement empty window", busy.Complement(hm("08:00"), hm("08:00")))
+}
+
+func TestSetPunch(t *testing.T) {
+	free := set("09:00", "17:00")
+	hole := NewInterval(1, hm("12:00"), hm("13:00"), 2)
+	checkSet(t, "Punch", free.Punch(hole), "09:00", "12:00", "13:00", "17:00")
+	checkSet(t, "Punch outside", free.Punch(NewInterval(1, hm("18:00"), hm("19:00"), 2)), "09:00", "17:00")
+}
+
+func TestPunch(t *testing.T) {
+	free := NewInterval(0, hm("09:00"), hm("17:00"), 0)
+	hole := NewInterval(1, hm("12:00"), hm("13:00"), 2)
+	ivs := free.Punch(hole)
+	Tassert(t, len(ivs) == 3, "expected 3 intervals, got %v", ivs)
+	Tassert(t, ivs[0].Start.Equal(hm("09:00")) && ivs[0].End.Equal(hm("12:00")) && !ivs[0].Busy(), "expected free time before the hole, got %v", ivs[0])
+	Tassert(t, ivs[1] == hole, "expected the hole, got %v", ivs[1])
+	Tassert(t, ivs[2].Start.Equal(hm("13:00")) && ivs[2].End.Equal(hm("17:00")) && !ivs[2].Busy(), "expected free time after the hole, got %v", ivs[2])
+
+	// a hole at the start leaves only the time after it
+	ivs = free.Punch(NewInterval(1, hm("09:00"), hm("10:00"), 2))
+	Tassert(t, len(ivs) == 2, "expected 2 intervals, got %v", ivs)
+
+	// busy intervals and holes outside the interval can't be punched
+	Tassert(t, hole.Punch(hole) == nil, "expected nil when punching a busy interval")
+	Tassert(t, free.Punch(NewInterval(1, hm("16:00"), hm("18:00"), 2)) == nil, "expected nil for a hole that sticks out")
+}
+
+func TestClone(t *testing.T) {
+	iv := NewInterval(1, hm("09:00"), hm("10:00"), 2)
+	iv.Payload = "standup"
+	iv.Resource = "alice"
+	cp := iv.Clone()
+	Tassert(t, cp != iv && *cp == *iv, "expected a copy of %v, got %v", iv, cp)
+	cp.Start = hm("09:30")
+	Tassert(t, iv.Start.Equal(hm("09:00")), "changing the clone changed the original")
+}
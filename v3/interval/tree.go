@@ -0,0 +1,276 @@
+package interval
+
+import (
+	"time"
+
+	"github.com/stevegt/timectl/v3/util"
+)
+
+// Tree is an augmented interval tree that holds intervals in memory,
+// without a database, for short-lived computations such as merging
+// imported calendars.  It is an AVL tree ordered by start time, in
+// which each node also records the latest end time in its subtree so
+// that stabbing and overlap queries can skip subtrees that end too
+// early.  A Tree is not safe for concurrent use.
+type Tree struct {
+	root *node
+	size int
+}
+
+// node is a node in a Tree.
+type node struct {
+	iv     *Interval
+	left   *node
+	right  *node
+	height int
+	// maxEnd is the latest end time in the subtree rooted at the
+	// node.
+	maxEnd time.Time
+}
+
+// NewTree returns a tree containing the given intervals.
+func NewTree(ivs ...*Interval) *Tree {
+	t := &Tree{}
+	for _, iv := range ivs {
+		t.Insert(iv)
+	}
+	return t
+}
+
+// Len returns the number of intervals in the tree.
+func (t *Tree) Len() int {
+	return t.size
+}
+
+// Insert adds an interval to the tree.  If the tree already holds an
+// interval with the same start time, end time, and id, it is
+// replaced.
+func (t *Tree) Insert(iv *Interval) {
+	var added bool
+	t.root, added = insert(t.root, iv)
+	if added {
+		t.size++
+	}
+}
+
+// Delete removes the interval with the same start time, end time, and
+// id as iv from the tree.  It returns false if there is no such
+// interval.
+func (t *Tree) Delete(iv *Interval) bool {
+	var deleted bool
+	t.root, deleted = remove(t.root, iv)
+	if deleted {
+		t.size--
+	}
+	return deleted
+}
+
+// Intervals returns all of the intervals in the tree in ascending
+// order of start time.
+func (t *Tree) Intervals() (ivs []*Interval) {
+	var walk func(n *node)
+	walk = func(n *node) {
+		if n == nil {
+			return
+		}
+		walk(n.left)
+		ivs = append(ivs, n.iv)
+		walk(n.right)
+	}
+	walk(t.root)
+	return
+}
+
+// Stab returns the intervals that contain the given time, in
+// ascending order of start time.  An interval contains its start time
+// but not its end time.
+func (t *Tree) Stab(at time.Time) []*Interval {
+	return t.Overlapping(at, at.Add(1))
+}
+
+// Overlapping returns the intervals that overlap the range from start
+// to end, in ascending order of start time.
+func (t *Tree) Overlapping(start, end time.Time) (ivs []*Interval) {
+	var walk func(n *node)
+	walk = func(n *node) {
+		if n == nil || !n.maxEnd.After(start) {
+			// nothing in this subtree ends after start
+			return
+		}
+		walk(n.left)
+		if !n.iv.Start.Before(end) {
+			// this node and everything to its right start too late
+			return
+		}
+		if n.iv.End.After(start) {
+			ivs = append(ivs, n.iv)
+		}
+		walk(n.right)
+	}
+	walk(t.root)
+	return
+}
+
+// FreeGap returns the earliest gap between busy intervals that starts
+// on or after the given time and is at least minDuration long.  A gap
+// always has a positive length, even if minDuration is zero.  Free
+// intervals in the tree are ignored.  If no busy interval follows the
+// gap, the gap is open-ended and end is the zero time.
+func (t *Tree) FreeGap(after time.Time, minDuration time.Duration) (start, end time.Time) {
+	cursor := after
+	found := false
+	var walk func(n *node)
+	walk = func(n *node) {
+		if found || n == nil || !n.maxEnd.After(cursor) {
+			// nothing in this subtree ends after the cursor
+			return
+		}
+		walk(n.left)
+		if found {
+			return
+		}
+		if n.iv.Busy() && n.iv.End.After(cursor) {
+			if n.iv.Start.After(cursor) && n.iv.Start.Sub(cursor) >= minDuration {
+				start, end = cursor, n.iv.Start
+				found = true
+				return
+			}
+			cursor = util.MaxTime(cursor, n.iv.End)
+		}
+		walk(n.right)
+	}
+	walk(t.root)
+	if !found {
+		return cursor, time.Time{}
+	}
+	return
+}
+
+// compare orders intervals by start time, then end time, then id.
+func compare(a, b *Interval) int {
+	switch {
+	case a.Start.Before(b.Start):
+		return -1
+	case a.Start.After(b.Start):
+		return 1
+	case a.End.Before(b.End):
+		return -1
+	case a.End.After(b.End):
+		return 1
+	case a.Id < b.Id:
+		return -1
+	case a.Id > b.Id:
+		return 1
+	}
+	return 0
+}
+
+// insert adds iv to the subtree rooted at n and returns the new root
+// of the subtree, and whether the subtree grew.
+func insert(n *node, iv *Interval) (*node, bool) {
+	if n == nil {
+		return &node{iv: iv, height: 1, maxEnd: iv.End}, true
+	}
+	var added bool
+	switch cmp := compare(iv, n.iv); {
+	case cmp < 0:
+		n.left, added = insert(n.left, iv)
+	case cmp > 0:
+		n.right, added = insert(n.right, iv)
+	default:
+		n.iv = iv
+	}
+	return rebalance(n), added
+}
+
+// remove removes iv from the subtree rooted at n and returns the new
+// root of the subtree, and whether iv was found.
+func remove(n *node, iv *Interval) (*node, bool) {
+	if n == nil {
+		return nil, false
+	}
+	var deleted bool
+	switch cmp := compare(iv, n.iv); {
+	case cmp < 0:
+		n.left, deleted = remove(n.left, iv)
+	case cmp > 0:
+		n.right, deleted = remove(n.right, iv)
+	default:
+		deleted = true
+		if n.left == nil {
+			return n.right, true
+		}
+		if n.right == nil {
+			return n.left, true
+		}
+		// replace this node's interval with its successor's
+		succ := n.right
+		for succ.left != nil {
+			succ = succ.left
+		}
+		n.iv = succ.iv
+		n.right, _ = remove(n.right, succ.iv)
+	}
+	return rebalance(n), deleted
+}
+
+// height returns the height of the subtree rooted at n.
+func height(n *node) int {
+	if n == nil {
+		return 0
+	}
+	return n.height
+}
+
+// update recomputes the height and maxEnd of n from its children.
+func update(n *node) {
+	n.height = 1 + max(height(n.left), height(n.right))
+	n.maxEnd = n.iv.End
+	if n.left != nil {
+		n.maxEnd = util.MaxTime(n.maxEnd, n.left.maxEnd)
+	}
+	if n.right != nil {
+		n.maxEnd = util.MaxTime(n.maxEnd, n.right.maxEnd)
+	}
+}
+
+// rebalance restores the AVL balance of the subtree rooted at n and
+// returns its new root.
+func rebalance(n *node) *node {
+	update(n)
+	switch balance := height(n.left) - height(n.right); {
+	case balance > 1:
+		if height(n.left.left) < height(n.left.right) {
+			n.left = rotateLeft(n.left)
+		}
+		return rotateRight(n)
+	case balance < -1:
+		if height(n.right.right) < height(n.right.left) {
+			n.right = rotateRight(n.right)
+		}
+		return rotateLeft(n)
+	}
+	return n
+}
+
+// rotateLeft rotates the subtree rooted at n to the left and returns
+// its new root.
+func rotateLeft(n *node) *node {
+	r := n.right
+	n.right = r.left
+	r.left = n
+	update(n)
+	update(r)
+	return r
+}
+
+// rotateRight rotates the subtree rooted at n to the right and
+// returns its new root.
+func rotateRight(n *node) *node {
+	l := n.left
+	n.left = l.right
+	l.right = n
+	update(n)
+	update(l)
+	return l
+}
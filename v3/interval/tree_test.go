@@ -0,0 +1,147 @@
+package interval
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestTree(t *testing.T) {
+	tree := NewTree(
+		NewInterval(1, hm("09:00"), hm("10:00"), 1),
+		NewInterval(2, hm("09:30"), hm("12:00"), 2),
+		NewInterval(3, hm("13:00"), hm("14:00"), 1),
+		NewInterval(4, hm("10:00"), hm("11:00"), 0),
+	)
+	Tassert(t, tree.Len() == 4, "expected 4 intervals, got %d", tree.Len())
+
+	ids := func(ivs []*Interval) (ids []uint64) {
+		for _, iv := range ivs {
+			ids = append(ids, iv.Id)
+		}
+		return
+	}
+	got := ids(tree.Stab(hm("09:45")))
+	Tassert(t, len(got) == 2 && got[0] == 1 && got[1] == 2, "expected [1 2], got %v", got)
+	// intervals don't contain their end time
+	got = ids(tree.Stab(hm("10:00")))
+	Tassert(t, len(got) == 2 && got[0] == 2 && got[1] == 4, "expected [2 4], got %v", got)
+	got = ids(tree.Stab(hm("12:30")))
+	Tassert(t, len(got) == 0, "expected nothing, got %v", got)
+
+	got = ids(tree.Overlapping(hm("11:30"), hm("13:30")))
+	Tassert(t, len(got) == 2 && got[0] == 2 && got[1] == 3, "expected [2 3], got %v", got)
+
+	// free interval 4 is not in the way
+	start, end := tree.FreeGap(hm("08:00"), 30*time.Minute)
+	Tassert(t, start.Equal(hm("08:00")) && end.Equal(hm("09:00")), "expected 08:00-09:00, got %v-%v", start, end)
+	start, end = tree.FreeGap(hm("09:15"), 30*time.Minute)
+	Tassert(t, start.Equal(hm("12:00")) && end.Equal(hm("13:00")), "expected 12:00-13:00, got %v-%v", start, end)
+	start, end = tree.FreeGap(hm("09:15"), 2*time.Hour)
+	Tassert(t, start.Equal(hm("14:00")) && end.IsZero(), "expected open-ended gap at 14:00, got %v-%v", start, end)
+	// an interval that starts at the given time leaves no gap there,
+	// even with no minimum duration
+	start, end = tree.FreeGap(hm("09:00"), 0)
+	Tassert(t, start.Equal(hm("12:00")) && end.Equal(hm("13:00")), "expected 12:00-13:00, got %v-%v", start, end)
+
+	Tassert(t, tree.Delete(NewInterval(2, hm("09:30"), hm("12:00"), 2)), "expected Delete to succeed")
+	Tassert(t, !tree.Delete(NewInterval(2, hm("09:30"), hm("12:00"), 2)), "expected second Delete to fail")
+	Tassert(t, tree.Len() == 3, "expected 3 intervals, got %d", tree.Len())
+	start, end = tree.FreeGap(hm("09:15"), 30*time.Minute)
+	Tassert(t, start.Equal(hm("10:00")) && end.Equal(hm("13:00")), "expected 10:00-13:00, got %v-%v", start, end)
+
+	// inserting the same interval again replaces it
+	tree.Insert(NewInterval(3, hm("13:00"), hm("14:00"), 5))
+	Tassert(t, tree.Len() == 3, "expected 3 intervals, got %d", tree.Len())
+	got = ids(tree.Intervals())
+	Tassert(t, len(got) == 3 && got[0] == 1 && got[1] == 4 && got[2] == 3, "expected [1 4 3], got %v", got)
+}
+
+// TestTreeRandom checks the tree against a brute force search of a
+// plain list.
+func TestTreeRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	base := hm("00:00")
+	minute := func(n int) time.Time { return base.Add(time.Duration(n) * time.Minute) }
+
+	tree := NewTree()
+	var list []*Interval
+	for i := 0; i < 2000; i++ {
+		if len(list) > 0 && rng.Intn(3) == 0 {
+			// delete a random interval
+			j := rng.Intn(len(list))
+			Tassert(t, tree.Delete(list[j]), "Delete(%v) failed", list[j])
+			list = append(list[:j], list[j+1:]...)
+		} else {
+			start := rng.Intn(1000)
+			iv := NewInterval(uint64(i), minute(start), minute(start+1+rng.Intn(60)), float64(rng.Intn(3)))
+			tree.Insert(iv)
+			list = append(list, iv)
+		}
+		Tassert(t, tree.Len() == len(list), "expected %d intervals, got %d", len(list), tree.Len())
+		checkBalanced(t, tree.root)
+
+		if i%50 != 0 {
+			continue
+		}
+		for q := 0; q < 20; q++ {
+			start := rng.Intn(1100)
+			end := start + rng.Intn(30)
+			got := tree.Overlapping(minute(start), minute(end))
+			var expect []*Interval
+			for _, iv := range list {
+				if iv.OverlapsRange(minute(start), minute(end)) {
+					expect = append(expect, iv)
+				}
+			}
+			Tassert(t, len(got) == len(expect), "Overlapping(%d, %d): expected %d intervals, got %d", start, end, len(expect), len(got))
+			for j := 1; j < len(got); j++ {
+				Tassert(t, !got[j].Start.Before(got[j-1].Start), "Overlapping results out of order: %v", got)
+			}
+
+			// the gap found must be free of busy intervals, and
+			// there must be no earlier one
+			minGap := time.Duration(rng.Intn(10)) * time.Minute
+			gapStart, gapEnd := tree.FreeGap(minute(start), minGap)
+			if gapEnd.IsZero() {
+				gapEnd = minute(2000)
+			}
+			Tassert(t, gapEnd.After(gapStart) && gapEnd.Sub(gapStart) >= minGap, "FreeGap(%d, %v): gap %v-%v is too short", start, minGap, gapStart, gapEnd)
+			for _, iv := range list {
+				Tassert(t, !iv.Busy() || !iv.OverlapsRange(gapStart, gapEnd), "FreeGap(%d, %v): gap %v-%v overlaps %v", start, minGap, gapStart, gapEnd, iv)
+			}
+			busy := IntervalSet{}
+			for _, iv := range list {
+				if iv.Busy() {
+					busy = append(busy, iv)
+				}
+			}
+			for _, free := range busy.Complement(minute(start), gapStart) {
+				Tassert(t, free.Duration() < minGap, "FreeGap(%d, %v): missed earlier gap %v", start, minGap, free)
+			}
+		}
+	}
+}
+
+// checkBalanced checks the AVL and maxEnd invariants of the subtree
+// rooted at n.
+func checkBalanced(t *testing.T, n *node) {
+	t.Helper()
+	if n == nil {
+		return
+	}
+	checkBalanced(t, n.left)
+	checkBalanced(t, n.right)
+	balance := height(n.left) - height(n.right)
+	Tassert(t, balance >= -1 && balance <= 1, "unbalanced node %v", n.iv)
+	Tassert(t, n.height == 1+max(height(n.left), height(n.right)), "bad height at %v", n.iv)
+	maxEnd := n.iv.End
+	for _, c := range []*node{n.left, n.right} {
+		if c != nil && c.maxEnd.After(maxEnd) {
+			maxEnd = c.maxEnd
+		}
+	}
+	Tassert(t, n.maxEnd.Equal(maxEnd), "bad maxEnd at %v", n.iv)
+}
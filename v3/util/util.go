@@ -1,10 +1,20 @@
 package util
 
 import (
+	"math"
 	"time"
 	// . "github.com/stevegt/goadapt"
 )
 
+// EarliestTime and LatestTime are the earliest and latest times that
+// can be represented as nanoseconds since the Unix epoch, which is
+// how the databases index times.  They stand in for the beginning
+// and end of time.
+var (
+	EarliestTime = time.Unix(0, math.MinInt64).UTC()
+	LatestTime   = time.Unix(0, math.MaxInt64).UTC()
+)
+
 // MinTime returns the earlier of two time.Time values.
 func MinTime(a, b time.Time) time.Time {
 	if a.Before(b) {